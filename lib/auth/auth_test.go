@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Github API that hands out installation tokens, and counts the requests it receives.
+type fakeGithubAPI struct {
+	sync.Mutex
+	// How long the tokens are valid
+	tokenLifetime time.Duration
+	// How long requests take
+	delay time.Duration
+	// The path the API is served at, Github Enterprise servers serve it at /api/v3
+	pathPrefix    string
+	installations int
+	tokens        int
+}
+
+func (api *fakeGithubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(api.delay)
+	api.Lock()
+	defer api.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, api.pathPrefix+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, api.pathPrefix)
+	switch {
+	case r.Method == "GET" && path == "/repos/bcd/missing/installation":
+		api.installations++
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == "GET" && strings.HasPrefix(path, "/repos/bcd/"):
+		api.installations++
+		fmt.Fprint(w, `{"id": 42}`)
+	case r.Method == "POST" && path == "/app/installations/42/access_tokens":
+		api.tokens++
+		var body struct {
+			Repositories []string
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("token-%d-%s", api.tokens, strings.Join(body.Repositories, ",")),
+			"expires_at": time.Now().Add(api.tokenLifetime),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (api *fakeGithubAPI) counts() (int, int) {
+	api.Lock()
+	defer api.Unlock()
+	return api.installations, api.tokens
+}
+
+func newTestApp(t *testing.T, api *fakeGithubAPI, repositories map[string]Repository) *GithubApp {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	server := httptest.NewServer(api)
+	app, err := NewGithubApp(1234, privateKeyPEM, "app secret", server.URL, repositories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestSignJWT(t *testing.T) {
+	app := newTestApp(t, &fakeGithubAPI{}, nil)
+	now := time.Unix(1500000000, 0)
+
+	jwt, err := app.signJWT(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT of 3 parts, got %q", jwt)
+	}
+
+	var header map[string]string
+	var claims map[string]int64
+	for i, v := range []interface{}{&header, &claims} {
+		decoded, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(decoded, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Fatalf("Expected a RS256 JWT, got header %v", header)
+	}
+	// The issue time is set in the past to allow for clock drift, Github doesn't accept JWTs valid for over 10 minutes
+	expectedClaims := map[string]int64{"iat": 1500000000 - 60, "exp": 1500000000 + 9*60, "iss": 1234}
+	for claim, expected := range expectedClaims {
+		if claims[claim] != expected {
+			t.Errorf("Expected claim %q to be %d, got %d", claim, expected, claims[claim])
+		}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(&app.PrivateKey.PublicKey, crypto.SHA256, hashed[:], signature)
+	if err != nil {
+		t.Fatalf("Expected the JWT to be signed using the private key of the app: %v", err)
+	}
+}
+
+func TestRequestTokenCaching(t *testing.T) {
+	api := &fakeGithubAPI{tokenLifetime: time.Hour}
+	app := newTestApp(t, api, nil)
+
+	token := app.RequestToken("bcd/octorunner")
+	if token == nil || token.AccessToken != "token-1-octorunner" {
+		t.Fatalf("Expected a token for %q only, got %v", "octorunner", token)
+	}
+	if cached := app.RequestToken("bcd/octorunner"); cached != token {
+		t.Fatalf("Expected the cached token %v, got %v", token, cached)
+	}
+
+	// The installation of the account is looked up once for all of its repositories
+	other := app.RequestToken("bcd/other")
+	if other == nil || other.AccessToken != "token-2-other" {
+		t.Fatalf("Expected a token for %q only, got %v", "other", other)
+	}
+	if installations, tokens := api.counts(); installations != 1 || tokens != 2 {
+		t.Fatalf("Expected 1 installation and 2 token requests, got %d and %d", installations, tokens)
+	}
+}
+
+func TestRequestTokenExpiry(t *testing.T) {
+	// Tokens that expire within tokenExpiryMargin are requested again
+	api := &fakeGithubAPI{tokenLifetime: tokenExpiryMargin - time.Minute}
+	app := newTestApp(t, api, nil)
+
+	first := app.RequestToken("bcd/octorunner")
+	second := app.RequestToken("bcd/octorunner")
+	if first == nil || second == nil || first.AccessToken == second.AccessToken {
+		t.Fatalf("Expected a new token to be requested, got %v and %v", first, second)
+	}
+	if _, tokens := api.counts(); tokens != 2 {
+		t.Fatalf("Expected 2 token requests, got %d", tokens)
+	}
+
+	// Expired tokens are dropped from the cache, instead of being kept for every repository that was ever built
+	app.RequestToken("bcd/other")
+	for key := range app.cache {
+		if strings.HasSuffix(key, "bcd/octorunner") {
+			t.Fatalf("Expected the expired token of %q to be dropped, got %q", "bcd/octorunner", key)
+		}
+	}
+}
+
+func TestRequestTokenFailure(t *testing.T) {
+	api := &fakeGithubAPI{tokenLifetime: time.Hour}
+	app := newTestApp(t, api, nil)
+
+	for i := 0; i < 3; i++ {
+		if token := app.RequestToken("bcd/missing"); token != nil {
+			t.Fatalf("Expected no token for a repository the app isn't installed on, got %v", token)
+		}
+	}
+	if installations, _ := api.counts(); installations != 1 {
+		t.Fatalf("Expected the failure to be cached, got %d installation requests", installations)
+	}
+
+	// The app can still be installed on other repositories of the account
+	if token := app.RequestToken("bcd/octorunner"); token == nil {
+		t.Fatal("Expected a token for a repository the app is installed on")
+	}
+}
+
+func TestRequestTokenConcurrently(t *testing.T) {
+	api := &fakeGithubAPI{tokenLifetime: time.Hour, delay: 50 * time.Millisecond}
+	app := newTestApp(t, api, nil)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if token := app.RequestToken("bcd/octorunner"); token != nil {
+				tokens[i] = token.AccessToken
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		if token != "token-1-octorunner" {
+			t.Fatalf("Expected every request to get the same token, got %v", tokens)
+		}
+	}
+	if installations, requests := api.counts(); installations != 1 || requests != 1 {
+		t.Fatalf("Expected 1 installation and 1 token request, got %d and %d", installations, requests)
+	}
+}
+
+func TestRequestTokenEnterprise(t *testing.T) {
+	api := &fakeGithubAPI{tokenLifetime: time.Hour}
+	enterprise := &fakeGithubAPI{tokenLifetime: time.Hour, pathPrefix: "/api/v3"}
+	server := httptest.NewServer(enterprise)
+	defer server.Close()
+	app := newTestApp(t, api, map[string]Repository{
+		"bcd/enterprise": {URL: server.URL},
+		// The address of the API of the server is accepted as well
+		"bcd/api": {URL: server.URL + "/api/v3/"},
+	})
+
+	for _, repoFullName := range []string{"bcd/enterprise", "bcd/api"} {
+		name := repoFullName[strings.Index(repoFullName, "/")+1:]
+		token := app.RequestToken(repoFullName)
+		if token == nil || !strings.HasSuffix(token.AccessToken, "-"+name) {
+			t.Fatalf("Expected a token for %q from the enterprise server, got %v", name, token)
+		}
+	}
+	// The same account on github.com has an installation of its own
+	if token := app.RequestToken("bcd/octorunner"); token == nil || token.AccessToken != "token-1-octorunner" {
+		t.Fatalf("Expected a token for %q from github.com, got %v", "octorunner", token)
+	}
+
+	if installations, tokens := enterprise.counts(); installations != 1 || tokens != 2 {
+		t.Fatalf("Expected 1 installation and 2 token requests on the enterprise server, got %d and %d",
+			installations, tokens)
+	}
+	if installations, tokens := api.counts(); installations != 1 || tokens != 1 {
+		t.Fatalf("Expected 1 installation and 1 token request on github.com, got %d and %d", installations, tokens)
+	}
+}
+
+func TestGithubAppOtherProviders(t *testing.T) {
+	api := &fakeGithubAPI{tokenLifetime: time.Hour}
+	app := newTestApp(t, api, map[string]Repository{
+		"bcd/gitea":      {Provider: "gitea", URL: "https://gitea.example.com"},
+		"bcd/configured": {Token: "configured token", Secret: "configured secret"},
+	})
+
+	if token := app.RequestToken("bcd/gitea"); token != nil && token.AccessToken != "" {
+		t.Fatalf("Expected no app token for a repository hosted on Gitea, got %q", token.AccessToken)
+	}
+	if secret := app.RequestSecret("bcd/gitea"); len(secret) != 0 {
+		t.Fatalf("Expected no app secret for a repository hosted on Gitea, got %q", secret)
+	}
+	if token := app.RequestToken("bcd/configured"); token == nil || token.AccessToken != "configured token" {
+		t.Fatalf("Expected the configured token, got %v", token)
+	}
+	if secret := app.RequestSecret("bcd/configured"); string(secret) != "configured secret" {
+		t.Fatalf("Expected the configured secret, got %q", secret)
+	}
+	if secret := app.RequestSecret("bcd/octorunner"); string(secret) != "app secret" {
+		t.Fatalf("Expected the secret of the app, got %q", secret)
+	}
+	if installations, tokens := api.counts(); installations != 0 || tokens != 0 {
+		t.Fatalf("Expected no requests, got %d installation and %d token requests", installations, tokens)
+	}
+}
@@ -3,18 +3,44 @@ package auth
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/subtle"
 	"fmt"
 	"golang.org/x/oauth2"
+	"hash"
 )
 
 /*
 Repository is used to store tokens and secrets per repository.
 Tokens are used for downloading private repositories, setting statuses, etc. Secret
 are used to verify clients.
+RequireSHA256 rejects deliveries that are only signed using HMAC-SHA1, RequireSignature rejects
+deliveries that can't be verified because no secret is configured.
+Provider is the name of the provider hosting the repository, and URL is the base URL of that provider.
+Both can be left empty for repositories on github.com. UploadURL is only used for Github Enterprise servers
+that don't serve uploads from the default location.
 */
 type Repository struct {
-	Token, Secret string
+	Token, Secret    string
+	RequireSHA256    bool `mapstructure:"require_sha256"`
+	RequireSignature bool `mapstructure:"require_signature"`
+	Provider, URL    string
+	UploadURL        string `mapstructure:"upload_url"`
+}
+
+/*
+ProviderConfig describes where a repository is hosted.
+*/
+type ProviderConfig struct {
+	Provider, URL, UploadURL string
+}
+
+/*
+SignaturePolicy describes which webhook signatures are accepted for a repository.
+*/
+type SignaturePolicy struct {
+	RequireSHA256    bool
+	RequireSignature bool
 }
 
 /*
@@ -23,13 +49,26 @@ Method is a simple interface every authentication method has to implement. This
 type Method interface {
 	RequestToken(repoFullName string) *oauth2.Token
 	RequestSecret(repoFullName string) []byte
+	RequestSignaturePolicy(repoFullName string) SignaturePolicy
+	RequestProviderConfig(repoFullName string) ProviderConfig
 }
 
 /*
-CalculateSignature calculates a signature based on a (repository's) secret.
+CalculateSignature calculates a HMAC-SHA1 signature based on a (repository's) secret.
 */
 func CalculateSignature(repoSecret []byte, payloadBody []byte) string {
-	mac := hmac.New(sha1.New, repoSecret)
+	return calculateHMAC(sha1.New, repoSecret, payloadBody)
+}
+
+/*
+CalculateSignatureSHA256 calculates a HMAC-SHA256 signature based on a (repository's) secret.
+*/
+func CalculateSignatureSHA256(repoSecret []byte, payloadBody []byte) string {
+	return calculateHMAC(sha256.New, repoSecret, payloadBody)
+}
+
+func calculateHMAC(h func() hash.Hash, repoSecret []byte, payloadBody []byte) string {
+	mac := hmac.New(h, repoSecret)
 	mac.Write(payloadBody)
 	return fmt.Sprintf("%x", mac.Sum(nil))
 }
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	githubAPIURL = "https://api.github.com/"
+	// Installation tokens are requested again when they expire within this margin, so they don't expire mid-build
+	tokenExpiryMargin = 5 * time.Minute
+	// The app can be installed on and removed from accounts at any time, so installations are looked up again
+	installationCacheDuration = time.Hour
+	// Failed requests aren't sent again during this interval, e.g. for repositories the app isn't installed on
+	failureCacheDuration = time.Minute
+)
+
+/*
+GithubApp authenticates as a Github App. Tokens are installation tokens for the repository they're requested
+for, which are cached until they're about to expire. Secrets are the webhook secret of the app.
+Repositories that are configured in Store use the token, secret and settings configured for them instead.
+Repositories that are configured with another provider than Github only use what's configured for them.
+*/
+type GithubApp struct {
+	SimpleAuth
+	AppID      int64
+	PrivateKey *rsa.PrivateKey
+	Secret     string
+	// The base URL of the Github API, defaults to api.github.com. Repositories that are configured with the URL of
+	// a Github Enterprise server use the API of that server instead.
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Guards cache, but isn't held while requests are sent
+	mutex sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+// The result of a request to the Github API, which is shared by everyone who asks for it until it expires.
+type cacheEntry struct {
+	// Closed once the request is done, whoever asks for the result in the meantime waits for it
+	done    chan struct{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+/*
+NewGithubApp creates a GithubApp from the app's ID, its PEM encoded private key and its webhook secret.
+*/
+func NewGithubApp(appID int64, privateKeyPEM []byte, secret string, baseURL string,
+	repositories map[string]Repository) (*GithubApp, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("Private key isn't PEM encoded")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		key, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pkcs8Err != nil {
+			return nil, fmt.Errorf("Couldn't parse private key: %v", err)
+		}
+		var isRSA bool
+		if privateKey, isRSA = key.(*rsa.PrivateKey); !isRSA {
+			return nil, errors.New("Private key isn't a RSA key")
+		}
+	}
+
+	if baseURL == "" {
+		baseURL = githubAPIURL
+	}
+	return &GithubApp{
+		SimpleAuth: SimpleAuth{Store: repositories},
+		AppID:      appID,
+		PrivateKey: privateKey,
+		Secret:     secret,
+		BaseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		HTTPClient: http.DefaultClient,
+		cache:      make(map[string]*cacheEntry),
+	}, nil
+}
+
+/*
+RequestToken returns an installation token for a specific repository. Nil is returned if the app isn't
+installed for the repository, or a token couldn't be requested.
+*/
+func (app *GithubApp) RequestToken(repoFullName string) *oauth2.Token {
+	if val, exists := app.Store[repoFullName]; exists && (val.Token != "" || !hostedOnGithub(val)) {
+		return app.SimpleAuth.RequestToken(repoFullName)
+	}
+
+	apiURL := app.apiURL(repoFullName)
+	token, err := app.cached("token:"+apiURL+repoFullName, func() (interface{}, time.Time, error) {
+		return app.requestInstallationToken(apiURL, repoFullName)
+	})
+	if err != nil {
+		log.Errorf("Couldn't request installation token for %q: %v", repoFullName, err)
+		return nil
+	}
+	return token.(*oauth2.Token)
+}
+
+/*
+RequestSecret returns the webhook secret of the app, unless a secret is configured for a specific repository.
+*/
+func (app *GithubApp) RequestSecret(repoFullName string) []byte {
+	if val, exists := app.Store[repoFullName]; exists && (val.Secret != "" || !hostedOnGithub(val)) {
+		return app.SimpleAuth.RequestSecret(repoFullName)
+	}
+	if app.Secret == "" {
+		return nil
+	}
+	return []byte(app.Secret)
+}
+
+// Returns whether a configured repository is hosted on Github, which is the case when it doesn't name a provider.
+func hostedOnGithub(repo Repository) bool {
+	return repo.Provider == "" || repo.Provider == "github"
+}
+
+// Returns the base URL of the API of the Github server hosting a repository. The URL configured for a repository
+// can be the address of its Github Enterprise server, or of the server's API.
+func (app *GithubApp) apiURL(repoFullName string) string {
+	repoURL := app.Store[repoFullName].URL
+	if repoURL == "" {
+		return app.BaseURL
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), "/api/v3") + "/api/v3/"
+}
+
+/*
+Return the result of a request to the Github API, which is only sent when there's no result for the same key that
+hasn't expired yet. Requests for different keys are sent concurrently, while whoever asks for a key that's being
+requested waits for that request. Failed requests are cached until the time they return, or for
+failureCacheDuration when they return the zero time. Expired results are dropped whenever a result is asked for.
+*/
+func (app *GithubApp) cached(key string, request func() (interface{}, time.Time, error)) (interface{}, error) {
+	app.mutex.Lock()
+	now := time.Now()
+	for cachedKey, entry := range app.cache {
+		select {
+		case <-entry.done:
+			if !now.Before(entry.expires) {
+				delete(app.cache, cachedKey)
+			}
+		default:
+		}
+	}
+
+	if entry, exists := app.cache[key]; exists {
+		app.mutex.Unlock()
+		<-entry.done
+		return entry.value, entry.err
+	}
+	entry := &cacheEntry{done: make(chan struct{})}
+	app.cache[key] = entry
+	app.mutex.Unlock()
+
+	entry.value, entry.expires, entry.err = request()
+	if entry.err != nil && entry.expires.IsZero() {
+		entry.expires = time.Now().Add(failureCacheDuration)
+	}
+	close(entry.done)
+	return entry.value, entry.err
+}
+
+// Request a token for a repository only, from the installation of the app on the repository's account.
+// Returns the token and when it has to be requested again.
+func (app *GithubApp) requestInstallationToken(apiURL string, repoFullName string) (*oauth2.Token, time.Time,
+	error) {
+	installationID, err := app.installation(apiURL, repoFullName)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	jwt, err := app.signJWT(time.Now())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var accessToken struct {
+		Token     string
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	repoName := repoFullName[strings.LastIndex(repoFullName, "/")+1:]
+	err = app.apiRequest(jwt, "POST", fmt.Sprintf("%sapp/installations/%d/access_tokens", apiURL, installationID),
+		map[string][]string{"repositories": {repoName}}, &accessToken)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	log.Debugf("Received installation token for %q, which expires at %s", repoFullName, accessToken.ExpiresAt)
+
+	return &oauth2.Token{AccessToken: accessToken.Token, Expiry: accessToken.ExpiresAt},
+		accessToken.ExpiresAt.Add(-tokenExpiryMargin), nil
+}
+
+// Find the installation of the app for a repository. An app is installed on an account, so the installation is
+// looked up once for all repositories of the same owner on the same server. A failed lookup isn't cached for the
+// owner, as the installation might only have access to some of its repositories.
+func (app *GithubApp) installation(apiURL string, repoFullName string) (int64, error) {
+	owner := repoFullName[:strings.LastIndex(repoFullName, "/")+1]
+	installationID, err := app.cached("installation:"+apiURL+owner, func() (interface{}, time.Time, error) {
+		jwt, err := app.signJWT(time.Now())
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		var installation struct {
+			ID int64
+		}
+		err = app.apiRequest(jwt, "GET", fmt.Sprintf("%srepos/%s/installation", apiURL, repoFullName), nil,
+			&installation)
+		if err != nil {
+			return nil, time.Now(), err
+		}
+		return installation.ID, time.Now().Add(installationCacheDuration), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return installationID.(int64), nil
+}
+
+// Create a JWT that identifies the app, signed using the app's private key. Github accepts JWTs that expire
+// within 10 minutes, and the issue time is set in the past to allow for clock drift.
+func (app *GithubApp) signJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, app.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("Couldn't sign JWT: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Send a request to an endpoint of the Github API, authenticated as the app.
+func (app *GithubApp) apiRequest(jwt string, method string, endpoint string, body interface{},
+	result interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, endpoint, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := app.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %q returned status %d", method, req.URL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
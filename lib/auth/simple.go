@@ -32,3 +32,28 @@ func (auth SimpleAuth) RequestSecret(repoFullName string) []byte {
 	}
 	return secret
 }
+
+/*
+RequestSignaturePolicy returns the signature policy that belongs to a specific repository.
+*/
+func (auth SimpleAuth) RequestSignaturePolicy(repoFullName string) SignaturePolicy {
+	var policy SignaturePolicy
+	if val, exists := auth.Store[repoFullName]; exists {
+		policy.RequireSHA256 = val.RequireSHA256
+		policy.RequireSignature = val.RequireSignature
+	}
+	return policy
+}
+
+/*
+RequestProviderConfig returns the provider configuration that belongs to a specific repository.
+*/
+func (auth SimpleAuth) RequestProviderConfig(repoFullName string) ProviderConfig {
+	var config ProviderConfig
+	if val, exists := auth.Store[repoFullName]; exists {
+		config.Provider = val.Provider
+		config.URL = val.URL
+		config.UploadURL = val.UploadURL
+	}
+	return config
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestCreateTarball(t *testing.T) {
@@ -62,3 +63,50 @@ func TestExtractDateAndOutput(t *testing.T) {
 		t.Fatalf("Data didn't %q didn't match %q", data, expectedData)
 	}
 }
+
+func TestParseCron(t *testing.T) {
+	invalid := []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * FOO *", "@often"}
+	for _, expression := range invalid {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("Expected an error for cron expression %q", expression)
+		}
+	}
+
+	// Monday the 2nd of January 2017
+	start := time.Date(2017, time.January, 2, 10, 30, 15, 0, time.UTC)
+	cases := []struct {
+		expression    string
+		expectedValue time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.January, 2, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.January, 2, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2017, time.January, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2017, time.January, 3, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2017, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2017, time.January, 2, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2017, time.January, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, time.January, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * MON-FRI", time.Date(2017, time.January, 2, 11, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2017, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 mar *", time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of the month or the day of the week has to match
+		{"0 0 13 * FRI", time.Date(2017, time.January, 6, 0, 0, 0, 0, time.UTC)},
+		// February never has 30 days
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, testCase := range cases {
+		schedule, err := ParseCron(testCase.expression)
+		if err != nil {
+			t.Errorf("Unexpected error for cron expression %q: %v", testCase.expression, err)
+			continue
+		}
+		val := schedule.Next(start)
+		if !val.Equal(testCase.expectedValue) {
+			t.Errorf("Expected %q to be next at %v, but got %v", testCase.expression, testCase.expectedValue, val)
+		}
+	}
+}
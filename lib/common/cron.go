@@ -0,0 +1,175 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression, which consists of five fields: minute, hour, day of the month, month
+// and day of the week. Every field is a comma separated list of values, ranges ("1-5") and wildcards ("*"),
+// which can be followed by a step ("*/15"). Months and days of the week can also be given by their English
+// abbreviation ("JAN", "MON"). As with cron, a time matches when either the day of the month or the day of the
+// week matches, if both are restricted.
+type CronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Whether the day fields are a wildcard, which changes how they're combined
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// Expressions that can be used instead of the five fields.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+var dayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// How far ahead we look for the next time a schedule matches, expressions like "0 0 30 2 *" never match.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+/*
+ParseCron parses a cron expression of five fields, or one of the descriptors "@yearly", "@annually", "@monthly",
+"@weekly", "@daily", "@midnight" and "@hourly".
+*/
+func ParseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if descriptor, exists := cronDescriptors[strings.ToLower(expression)]; exists {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 fields in cron expression %q, got %d", expression, len(fields))
+	}
+
+	var schedule CronSchedule
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfMonth, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 are Sunday
+	if schedule.dayOfWeek, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+	schedule.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	return &schedule, nil
+}
+
+/*
+Next returns the first time after the given time the schedule matches, with a precision of a minute. Returns the
+zero time if the schedule doesn't match within the next five years.
+*/
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Parse a field of a cron expression into a bitset of the values it matches.
+func parseCronField(field string, min int, max int, names []string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		valueRange, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			valueRange = part[:i]
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("Invalid step in cron field %q", field)
+			}
+		}
+
+		start, end := min, max
+		if valueRange != "*" {
+			bounds := strings.SplitN(valueRange, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], min, max, names); err != nil {
+				return 0, fmt.Errorf("Invalid cron field %q: %v", field, err)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], min, max, names); err != nil {
+					return 0, fmt.Errorf("Invalid cron field %q: %v", field, err)
+				}
+			} else if step > 1 {
+				// "5/15" means every 15th value starting at 5
+				end = max
+			}
+			if end < start {
+				return 0, fmt.Errorf("Invalid range in cron field %q", field)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+// Parse a single value of a cron field, which is either a number or a name. Names are numbered starting at min.
+func parseCronValue(value string, min int, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return min + i, nil
+		}
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a number", value)
+	}
+	if number < min || number > max {
+		return 0, fmt.Errorf("%d isn't between %d and %d", number, min, max)
+	}
+	return number, nil
+}
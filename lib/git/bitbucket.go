@@ -0,0 +1,285 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	bitbucketEventHeader     = "X-Event-Key"
+	bitbucketDeliveryHeader  = "X-Request-UUID"
+	bitbucketSignatureHeader = "X-Hub-Signature"
+	// Used when no URL is configured for a repository
+	bitbucketDefaultURL    = "https://bitbucket.org"
+	bitbucketDefaultAPIURL = "https://api.bitbucket.org/2.0"
+)
+
+// bitbucketProvider implements Provider for repositories hosted on Bitbucket Cloud. See bitbucketServerProvider
+// for Bitbucket Server.
+type bitbucketProvider struct{}
+
+type bitbucketPayload struct {
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	// Only set for repo:push events
+	Push struct {
+		Changes []struct {
+			// Not set when the change created a ref
+			Old *struct {
+				Type string
+				Name string
+			} `json:"old"`
+			// Not set when the change deleted a ref
+			New *struct {
+				Type   string
+				Name   string
+				Target struct {
+					Hash    string
+					Message string
+				} `json:"target"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	// Only set for pullrequest:* events
+	PullRequest struct {
+		ID     int
+		Source struct {
+			Commit struct {
+				Hash string
+			} `json:"commit"`
+			Branch struct {
+				Name string
+			} `json:"branch"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		} `json:"source"`
+	} `json:"pullrequest"`
+}
+
+func (p bitbucketProvider) Name() string {
+	return "bitbucket"
+}
+
+func (p bitbucketProvider) Handles(headers http.Header) bool {
+	return headers.Get(bitbucketEventHeader) != ""
+}
+
+func (p bitbucketProvider) Event(headers http.Header) string {
+	return headers.Get(bitbucketEventHeader)
+}
+
+func (p bitbucketProvider) DeliveryID(headers http.Header) string {
+	return headers.Get(bitbucketDeliveryHeader)
+}
+
+func (p bitbucketProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	if event != "repo:push" && !strings.HasPrefix(event, "pullrequest:") {
+		return nil, ErrUnsupportedEvent
+	}
+
+	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
+	var payload bitbucketPayload
+	err := jsonDecoder.Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Decoded payload to ", payload)
+
+	// The full name of a repository consists of the workspace and the repository's slug
+	fullName := payload.Repository.FullName
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: fullName,
+		},
+	}
+	if i := strings.Index(fullName, "/"); i >= 0 {
+		webhook.Repository.Owner = fullName[:i]
+		webhook.Repository.Name = fullName[i+1:]
+	}
+
+	if event == "repo:push" {
+		log.Info("Repository \"" + fullName + "\" was pushed to")
+		// A single push can update multiple refs, every one of them is handled
+		var webhooks []*Webhook
+		for _, change := range payload.Push.Changes {
+			refWebhook := &Webhook{Repository: webhook.Repository}
+			switch {
+			case change.New != nil:
+				refWebhook.CommitID = change.New.Target.Hash
+				refWebhook.HeadCommitMessage = change.New.Target.Message
+				refWebhook.Ref = bitbucketRef(change.New.Type, change.New.Name)
+			case change.Old != nil:
+				refWebhook.Ref = bitbucketRef(change.Old.Type, change.Old.Name)
+				refWebhook.Deleted = true
+				log.Infof("Ref %q of repository %q was deleted", refWebhook.Ref, fullName)
+			default:
+				continue
+			}
+			webhooks = append(webhooks, refWebhook)
+		}
+		if len(webhooks) == 0 {
+			webhook.Ignored = "the push didn't change any refs"
+			return webhook, nil
+		}
+		webhooks[0].Others = webhooks[1:]
+		return webhooks[0], nil
+	}
+
+	pullRequest := payload.PullRequest
+	webhook.CommitID = pullRequest.Source.Commit.Hash
+	webhook.Ref = fmt.Sprintf("refs/pull-requests/%d/from", pullRequest.ID)
+	webhook.PullRequest = pullRequest.ID
+	if pullRequest.Source.Repository.FullName == fullName {
+		webhook.HeadRef = bitbucketRef("branch", pullRequest.Source.Branch.Name)
+	}
+	switch event {
+	case "pullrequest:created", "pullrequest:updated":
+		log.Infof("Pull request #%d of %q was %s", pullRequest.ID, fullName,
+			strings.TrimPrefix(event, "pullrequest:"))
+	default:
+		webhook.Ignored = fmt.Sprintf("not doing anything for pull request event %q", event)
+	}
+
+	return webhook, nil
+}
+
+func (p bitbucketProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	return verifyBitbucketSignature(headers, payloadBody, repoSecret)
+}
+
+// Both Bitbucket Cloud and Bitbucket Server sign deliveries using HMAC-SHA256 when a secret is configured for
+// the webhook.
+func verifyBitbucketSignature(headers http.Header, payloadBody []byte, repoSecret []byte) string {
+	signature := headers.Get(bitbucketSignatureHeader)
+	if signature == "" {
+		log.Error("Expected signature for payload, but none given")
+		return signatureMissing
+	}
+
+	calculatedSignature := "sha256=" + authentication.CalculateSignatureSHA256(repoSecret, payloadBody)
+	log.Debug("Received signature " + signature)
+	log.Debug("Calculated signature ", calculatedSignature)
+	if !authentication.CompareSignatures([]byte(signature), []byte(calculatedSignature)) {
+		log.Error("Signatures didn't match")
+		return signatureInvalid
+	}
+
+	return signatureValid
+}
+
+func (p bitbucketProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	var refPath string
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		refPath = "branches/" + url.PathEscape(strings.TrimPrefix(ref, "refs/heads/"))
+	case strings.HasPrefix(ref, "refs/tags/"):
+		refPath = "tags/" + url.PathEscape(strings.TrimPrefix(ref, "refs/tags/"))
+	default:
+		return "", fmt.Errorf("Can't resolve ref %q of %q", ref, repo.FullName)
+	}
+
+	var resolvedRef struct {
+		Target struct {
+			Hash string
+		}
+	}
+	err := apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "GET",
+		fmt.Sprintf("%s/refs/%s", p.apiURL(repo), refPath), nil, &resolvedRef)
+	if err != nil {
+		return "", err
+	}
+
+	return resolvedRef.Target.Hash, nil
+}
+
+func (p bitbucketProvider) FetchSource(ctx context.Context, repo Repository, repoToken *oauth2.Token,
+	commitID string) (string, error) {
+	log.Info("Downloading archive of commit " + commitID)
+	archiveURL, err := url.Parse(fmt.Sprintf("%s/%s/%s/get/%s.zip", p.webURL(repo), url.PathEscape(repo.Owner),
+		url.PathEscape(repo.Name), commitID))
+	if err != nil {
+		return "", fmt.Errorf("Error while constructing archive URL: %v", err)
+	}
+
+	return downloadArchive(oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken)), archiveURL)
+}
+
+func (p bitbucketProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	path string) ([]byte, error) {
+	return apiDownload(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)),
+		fmt.Sprintf("%s/src/%s/%s", p.apiURL(repo), commitID, path))
+}
+
+func (p bitbucketProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	state string, description string) error {
+	bitbucketStates := map[string]string{
+		"pending": "INPROGRESS",
+		"success": "SUCCESSFUL",
+		"failure": "FAILED",
+		"error":   "FAILED",
+	}
+
+	// Bitbucket requires a URL for every build status, we link to the commit itself
+	status := map[string]string{
+		"state": bitbucketStates[state],
+		"key":   "octorunner",
+		"name":  "continuous-integration/octorunner",
+		"url": fmt.Sprintf("%s/%s/%s/commits/%s", p.webURL(repo), url.PathEscape(repo.Owner),
+			url.PathEscape(repo.Name), commitID),
+	}
+	if description != "" {
+		status["description"] = description
+	}
+	return apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "POST",
+		fmt.Sprintf("%s/commit/%s/statuses/build", p.apiURL(repo), commitID), status, nil)
+}
+
+func (p bitbucketProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	cloneURL, err := url.Parse(fmt.Sprintf("%s/%s/%s.git", p.webURL(repo), repo.Owner, repo.Name))
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		cloneURL.User = url.UserPassword("x-token-auth", token.AccessToken)
+	}
+	return cloneURL, nil
+}
+
+// Returns the full name of a branch or tag.
+func bitbucketRef(refType string, name string) string {
+	if refType == "tag" {
+		return "refs/tags/" + name
+	}
+	return "refs/heads/" + name
+}
+
+// Returns the address of Bitbucket Cloud, or the address configured for a repository.
+func (p bitbucketProvider) webURL(repo Repository) string {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return bitbucketDefaultURL
+	}
+	return baseURL
+}
+
+// Returns the URL of the API endpoints of a repository. Bitbucket Cloud also serves its API below "/api/2.0",
+// which is used when an address is configured for the repository.
+func (p bitbucketProvider) apiURL(repo Repository) string {
+	apiURL := bitbucketDefaultAPIURL
+	if baseURL, err := providerURL(repo.FullName); err == nil {
+		apiURL = baseURL + "/api/2.0"
+	}
+	return fmt.Sprintf("%s/repositories/%s/%s", apiURL, url.PathEscape(repo.Owner), url.PathEscape(repo.Name))
+}
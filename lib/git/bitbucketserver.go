@@ -0,0 +1,253 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const bitbucketServerDeliveryHeader = "X-Request-Id"
+
+// bitbucketServerProvider implements Provider for repositories hosted on Bitbucket Server (Data Center).
+type bitbucketServerProvider struct{}
+
+type bitbucketServerRepository struct {
+	Slug    string
+	Project struct {
+		Key string
+	} `json:"project"`
+}
+
+type bitbucketServerPayload struct {
+	Repository bitbucketServerRepository `json:"repository"`
+	// Only set for repo:refs_changed events
+	Changes []struct {
+		Ref struct {
+			ID string
+		} `json:"ref"`
+		ToHash string `json:"toHash"`
+		// "ADD", "UPDATE" or "DELETE"
+		Type string
+	} `json:"changes"`
+	// Only set for pr:* events
+	PullRequest struct {
+		ID      int
+		FromRef struct {
+			ID           string
+			LatestCommit string                    `json:"latestCommit"`
+			Repository   bitbucketServerRepository `json:"repository"`
+		} `json:"fromRef"`
+		ToRef struct {
+			Repository bitbucketServerRepository `json:"repository"`
+		} `json:"toRef"`
+	} `json:"pullRequest"`
+}
+
+// Returns the full name of a repository, which consists of the key of its project and its slug.
+func (r bitbucketServerRepository) fullName() string {
+	return r.Project.Key + "/" + r.Slug
+}
+
+func (p bitbucketServerProvider) Name() string {
+	return "bitbucket-server"
+}
+
+// Bitbucket Cloud's events are named "repo:push" and "pullrequest:*" instead.
+func (p bitbucketServerProvider) Handles(headers http.Header) bool {
+	event := headers.Get(bitbucketEventHeader)
+	return event == "repo:refs_changed" || event == "diagnostics:ping" || strings.HasPrefix(event, "pr:")
+}
+
+func (p bitbucketServerProvider) Event(headers http.Header) string {
+	return headers.Get(bitbucketEventHeader)
+}
+
+func (p bitbucketServerProvider) DeliveryID(headers http.Header) string {
+	return headers.Get(bitbucketServerDeliveryHeader)
+}
+
+func (p bitbucketServerProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	if event != "repo:refs_changed" && !strings.HasPrefix(event, "pr:") {
+		return nil, ErrUnsupportedEvent
+	}
+
+	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
+	var payload bitbucketServerPayload
+	err := jsonDecoder.Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Decoded payload to ", payload)
+
+	repo := payload.Repository
+	if strings.HasPrefix(event, "pr:") {
+		repo = payload.PullRequest.ToRef.Repository
+	}
+	fullName := repo.fullName()
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: fullName,
+			Owner:    repo.Project.Key,
+			Name:     repo.Slug,
+		},
+	}
+
+	if event == "repo:refs_changed" {
+		log.Info("Repository \"" + fullName + "\" was pushed to")
+		// A single push can update multiple refs, every one of them is handled
+		var webhooks []*Webhook
+		for _, change := range payload.Changes {
+			refWebhook := &Webhook{Repository: webhook.Repository, CommitID: change.ToHash, Ref: change.Ref.ID}
+			if change.Type == "DELETE" || isNullCommit(change.ToHash) {
+				log.Infof("Ref %q of repository %q was deleted", change.Ref.ID, fullName)
+				refWebhook.CommitID = ""
+				refWebhook.Deleted = true
+			}
+			webhooks = append(webhooks, refWebhook)
+		}
+		if len(webhooks) == 0 {
+			webhook.Ignored = "the push didn't change any refs"
+			return webhook, nil
+		}
+		webhooks[0].Others = webhooks[1:]
+		return webhooks[0], nil
+	}
+
+	pullRequest := payload.PullRequest
+	webhook.CommitID = pullRequest.FromRef.LatestCommit
+	webhook.Ref = fmt.Sprintf("refs/pull-requests/%d/from", pullRequest.ID)
+	webhook.PullRequest = pullRequest.ID
+	if pullRequest.FromRef.Repository.fullName() == fullName {
+		webhook.HeadRef = pullRequest.FromRef.ID
+	}
+	switch event {
+	case "pr:opened":
+		log.Infof("Pull request #%d of %q was opened", pullRequest.ID, fullName)
+	case "pr:from_ref_updated":
+		log.Infof("Pull request #%d of %q received new commits", pullRequest.ID, fullName)
+	default:
+		webhook.Ignored = fmt.Sprintf("not doing anything for pull request event %q", event)
+	}
+
+	return webhook, nil
+}
+
+func (p bitbucketServerProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	return verifyBitbucketSignature(headers, payloadBody, repoSecret)
+}
+
+func (p bitbucketServerProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return "", err
+	}
+
+	var commits struct {
+		Values []struct {
+			ID string
+		}
+	}
+	err = apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "GET",
+		fmt.Sprintf("%s/commits?until=%s&limit=1", apiURL, url.QueryEscape(ref)), nil, &commits)
+	if err != nil {
+		return "", err
+	}
+	if len(commits.Values) == 0 {
+		return "", fmt.Errorf("Ref %q of %q doesn't point to a commit", ref, repo.FullName)
+	}
+
+	return commits.Values[0].ID, nil
+}
+
+func (p bitbucketServerProvider) FetchSource(ctx context.Context, repo Repository, repoToken *oauth2.Token,
+	commitID string) (string, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return "", err
+	}
+
+	// The archive is prefixed with a directory, which is where the source ends up
+	log.Info("Downloading archive of commit " + commitID)
+	archiveURL, err := url.Parse(fmt.Sprintf("%s/archive?at=%s&format=zip&prefix=%s/", apiURL,
+		url.QueryEscape(commitID), url.QueryEscape(repo.Name)))
+	if err != nil {
+		return "", fmt.Errorf("Error while constructing archive URL: %v", err)
+	}
+
+	return downloadArchive(oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken)), archiveURL)
+}
+
+func (p bitbucketServerProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token,
+	commitID string, path string) ([]byte, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiDownload(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)),
+		fmt.Sprintf("%s/raw/%s?at=%s", apiURL, path, url.QueryEscape(commitID)))
+}
+
+func (p bitbucketServerProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token,
+	commitID string, state string, description string) error {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return err
+	}
+
+	bitbucketStates := map[string]string{
+		"pending": "INPROGRESS",
+		"success": "SUCCESSFUL",
+		"failure": "FAILED",
+		"error":   "FAILED",
+	}
+
+	// Bitbucket requires a URL for every build status, we link to the commit itself
+	status := map[string]string{
+		"state": bitbucketStates[state],
+		"key":   "octorunner",
+		"name":  "continuous-integration/octorunner",
+		"url": fmt.Sprintf("%s/projects/%s/repos/%s/commits/%s", baseURL, url.PathEscape(repo.Owner),
+			url.PathEscape(repo.Name), commitID),
+	}
+	if description != "" {
+		status["description"] = description
+	}
+	return apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "POST",
+		fmt.Sprintf("%s/rest/build-status/1.0/commits/%s", baseURL, commitID), status, nil)
+}
+
+func (p bitbucketServerProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return nil, err
+	}
+	cloneURL, err := url.Parse(fmt.Sprintf("%s/scm/%s/%s.git", baseURL, strings.ToLower(repo.Owner), repo.Name))
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		cloneURL.User = url.UserPassword("x-token-auth", token.AccessToken)
+	}
+	return cloneURL, nil
+}
+
+// Returns the URL of the API endpoints of a repository. Bitbucket Server is always self-hosted, so an address
+// has to be configured for the repository.
+func (p bitbucketServerProvider) apiURL(repo Repository) (string, error) {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s", baseURL, url.PathEscape(repo.Owner),
+		url.PathEscape(repo.Name)), nil
+}
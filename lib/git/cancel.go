@@ -0,0 +1,244 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"github.com/docker/docker/client"
+	"golang.org/x/net/context"
+	"os"
+	"strings"
+	"sync"
+)
+
+// AutoCancel enables cancelling the queued and running jobs of a ref, when a newer commit is pushed to the same ref.
+var AutoCancel bool
+
+// ErrJobNotActive is returned when a job is cancelled that isn't queued or running.
+var ErrJobNotActive = errors.New("Job isn't queued or running")
+
+// A job that's being ran by a worker.
+type runningJob struct {
+	cancel context.CancelFunc
+	// Why the job was cancelled, empty as long as it isn't
+	reason string
+}
+
+// The jobs that are being ran by the workers, so they can be cancelled.
+var runningJobs = struct {
+	sync.Mutex
+	jobs map[int64]*runningJob
+}{jobs: make(map[int64]*runningJob)}
+
+// Register a job that's being ran, cancel stops everything that's being done for it. A job that was cancelled
+// after it was dequeued but before it was registered is cancelled right away.
+func trackJob(jobID int64, cancel context.CancelFunc) {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+
+	if pending, exists := runningJobs.jobs[jobID]; exists {
+		pending.cancel = cancel
+		cancel()
+		return
+	}
+	runningJobs.jobs[jobID] = &runningJob{cancel: cancel}
+}
+
+// Unregister a job that's done running. Returns why the job was cancelled, or an empty string if it wasn't.
+func untrackJob(jobID int64) string {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+
+	running, exists := runningJobs.jobs[jobID]
+	if !exists {
+		return ""
+	}
+	delete(runningJobs.jobs, jobID)
+	return running.reason
+}
+
+/*
+Cancel the queued and running jobs of the same project and ref that were created for an earlier push of another
+commit, now that the given job was queued for a push. Jobs that were triggered, retried or scheduled are left alone,
+as are jobs of the same commit, e.g. when a delivery is forced to be built again.
+*/
+func cancelSuperseded(b *build, jobID int64) {
+	jobs, err := persist.DBConn.FindActiveJobsForRef(b.repo.Name, b.repo.Owner, b.ref)
+	if err != nil {
+		log.Errorf("Error while looking for jobs superseded by job %d: %v", jobID, err)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.ID >= jobID || !job.Pushed || job.CommitID == b.commitID {
+			continue
+		}
+		log.Infof("Job %d for %q is superseded by job %d", job.ID, b.ref, jobID)
+		err = cancelJob(job, fmt.Sprintf("Cancelled, superseded by job %d", jobID))
+		if err != nil {
+			log.Errorf("Error while cancelling job %d: %v", job.ID, err)
+		}
+	}
+}
+
+/*
+Cancel all queued and running jobs of a ref that was deleted, including those of pull requests that were opened from
+it when it's a branch, and remove the ref from the project's mirror. Returns the IDs of the cancelled jobs.
+*/
+func cancelDeletedRef(provider Provider, repo Repository, ref string) ([]int64, error) {
+	jobs, err := persist.DBConn.FindActiveJobsForRef(repo.Name, repo.Owner, ref)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(ref, pipeline.BranchRefPrefix) {
+		pullRequestJobs, err := persist.DBConn.FindActiveJobsForHeadRef(repo.Name, repo.Owner, ref)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, pullRequestJobs...)
+	}
+
+	if err := pruneMirrorRef(provider, repo, ref); err != nil {
+		log.Errorf("Error while removing %q from the mirror of %q: %v", ref, repo.FullName, err)
+	}
+
+	cancelled := []int64{}
+	for _, job := range jobs {
+		err = cancelJob(job, fmt.Sprintf("Cancelled, %q was deleted", ref))
+		if err != nil {
+			log.Errorf("Error while cancelling job %d: %v", job.ID, err)
+			continue
+		}
+		cancelled = append(cancelled, job.ID)
+	}
+
+	return cancelled, nil
+}
+
+/*
+CancelJob cancels a queued or running job on behalf of someone, whose name is recorded in the status of the job
+and in the status of its commit. Running jobs are cancelled asynchronously, the worker running them stops and
+removes their container.
+*/
+func CancelJob(job persist.Job, by string) error {
+	if !job.Active() {
+		return ErrJobNotActive
+	}
+
+	reason := "Cancelled"
+	if by != "" {
+		reason = fmt.Sprintf("Cancelled by %s", by)
+	}
+	log.Infof("Cancelling job %d, requested by %q", job.ID, by)
+
+	return cancelJob(job, reason)
+}
+
+/*
+Cancel a queued or running job. Queued jobs are removed from the queue, running jobs are stopped by the worker
+running them, which then stops their container.
+*/
+func cancelJob(job persist.Job, reason string) (err error) {
+	cancelled, err := persist.DBConn.CancelQueuedJob(job.ID, reason)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		log.Infof("Removed job %d from the queue", job.ID)
+		b, err := jobBuild(job)
+		if err != nil {
+			return err
+		}
+		reportCancelled(context.Background(), b, reason)
+		return nil
+	}
+
+	runningJobs.Lock()
+	running, exists := runningJobs.jobs[job.ID]
+	if exists {
+		defer runningJobs.Unlock()
+		if running.reason != "" {
+			// The job is already being stopped
+			return nil
+		}
+		log.Infof("Stopping job %d", job.ID)
+		running.reason = reason
+		running.cancel()
+		return nil
+	}
+
+	// A worker might have dequeued the job without having started to run it yet, it's stopped once it does.
+	// The entry is removed again when the job turns out not to be running, unless a worker picked it up already.
+	pending := &runningJob{reason: reason}
+	runningJobs.jobs[job.ID] = pending
+	runningJobs.Unlock()
+	defer func() {
+		if err == nil {
+			return
+		}
+		runningJobs.Lock()
+		defer runningJobs.Unlock()
+		if runningJobs.jobs[job.ID] == pending && pending.cancel == nil {
+			delete(runningJobs.jobs, job.ID)
+		}
+	}()
+
+	current, err := persist.DBConn.FindJob(job.ID)
+	if err != nil {
+		return err
+	}
+	if !current.Active() {
+		return ErrJobNotActive
+	}
+	log.Infof("Job %d will be stopped when it starts running", job.ID)
+
+	return nil
+}
+
+/*
+Clean up after a running job was cancelled. Its container is stopped and removed, as is its workspace when
+it has one, and its status is set to "cancelled". A job that finished before it could be stopped keeps its status.
+*/
+func finishCancelledJob(b build, jobID int64, workspace string, reason string) {
+	ctx := context.Background()
+
+	if workspace != "" {
+		log.Debugf("Removing workspace %q of job %d", workspace, jobID)
+		if err := os.RemoveAll(workspace); err != nil {
+			log.Errorf("Error while removing workspace of job %d: %v", jobID, err)
+		}
+	}
+
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		log.Errorf("Error while creating connection to Docker: %q", err)
+	} else {
+		defer cli.Close()
+		err = pipeline.StopJob(ctx, cli, b.repo.FullName, b.commitID, jobID)
+		if err != nil {
+			log.Errorf("Error while stopping job %d: %v", jobID, err)
+		}
+	}
+
+	cancelled, err := persist.DBConn.CancelRunningJob(jobID, reason)
+	if err != nil {
+		log.Errorf("Error while updating status of job %d: %v", jobID, err)
+		return
+	}
+	if !cancelled {
+		log.Infof("Job %d finished before it could be stopped", jobID)
+		return
+	}
+	reportCancelled(ctx, b, reason)
+}
+
+// Set the status of the commit of a cancelled job.
+func reportCancelled(ctx context.Context, b build, reason string) {
+	repoToken := repositoryToken(b.repo.FullName)
+	if repoToken == nil {
+		return
+	}
+	setStatus(ctx, b, repoToken, "error", reason)
+}
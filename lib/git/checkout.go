@@ -0,0 +1,309 @@
+package git
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/common"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MirrorDir is the directory in which a bare mirror is kept for every project that's checked out using git.
+var MirrorDir = "mirrors"
+
+// The oldest version of git that can check out commits, as credentials are passed using GIT_CONFIG_COUNT.
+var minGitVersion = []int{2, 31}
+
+/*
+CheckGitVersion returns an error when git isn't installed, or when it's older than the version that checkout
+mode "git" requires.
+*/
+func CheckGitVersion() error {
+	output, err := outputGit(context.Background(), "", nil, "version")
+	if err != nil {
+		return err
+	}
+	return checkGitVersion(output)
+}
+
+// Check the output of "git version", e.g. "git version 2.39.2" or "git version 2.32.1 (Apple Git-133)".
+func checkGitVersion(output string) error {
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return fmt.Errorf("Unexpected output of git version: %q", output)
+	}
+
+	numbers := strings.Split(fields[2], ".")
+	for i, minNumber := range minGitVersion {
+		var number int
+		if i < len(numbers) {
+			var err error
+			if number, err = strconv.Atoi(numbers[i]); err != nil {
+				return fmt.Errorf("Unexpected git version %q", fields[2])
+			}
+		}
+		if number > minNumber {
+			break
+		}
+		if number < minNumber {
+			return fmt.Errorf("git %s is installed, but checking out commits requires git %d.%d or later",
+				fields[2], minGitVersion[0], minGitVersion[1])
+		}
+	}
+
+	return nil
+}
+
+// Builds of the same project use the same mirror, so they take turns updating it.
+var mirrorLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+func lockMirror(mirrorPath string) *sync.Mutex {
+	mirrorLocks.Lock()
+	defer mirrorLocks.Unlock()
+
+	lock, exists := mirrorLocks.locks[mirrorPath]
+	if !exists {
+		lock = &sync.Mutex{}
+		mirrorLocks.locks[mirrorPath] = lock
+	}
+	lock.Lock()
+	return lock
+}
+
+// Returns the path of the bare mirror of a project.
+func projectMirrorPath(provider Provider, repo Repository) (string, error) {
+	return filepath.Abs(filepath.Join(MirrorDir, provider.Name(), repo.FullName+".git"))
+}
+
+/*
+Remove a ref that was deleted from a project from its mirror, if the project has one. Tags are fetched into the
+mirror along with every build, so a deleted tag would otherwise be checked out by later builds.
+*/
+func pruneMirrorRef(provider Provider, repo Repository, ref string) error {
+	mirrorPath, err := projectMirrorPath(provider, repo)
+	if err != nil {
+		return err
+	}
+	if common.CheckDirNotExists(mirrorPath) {
+		return nil
+	}
+	lock := lockMirror(mirrorPath)
+	defer lock.Unlock()
+
+	ctx := context.Background()
+	if err := runGit(ctx, mirrorPath, nil, "show-ref", "--verify", "--quiet", ref); err != nil {
+		// The ref isn't in the mirror
+		return nil
+	}
+	log.Infof("Removing %q from the mirror of %q", ref, repo.FullName)
+	return runGit(ctx, mirrorPath, nil, "update-ref", "-d", ref)
+}
+
+// The credentials git uses for a server. They're only sent to the server the repository is hosted on, not to
+// servers hosting submodules for example.
+type gitCredentials struct {
+	server string
+	header string
+}
+
+// Returns the configuration git needs to use the credentials, as environment variables.
+func (c gitCredentials) env() []string {
+	return []string{
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=http." + c.server + ".extraHeader",
+		"GIT_CONFIG_VALUE_0=" + c.header,
+		// Submodules are often configured with SSH URLs, which we don't have credentials for
+		"GIT_CONFIG_KEY_1=url." + c.server + ".insteadOf",
+		"GIT_CONFIG_VALUE_1=git@" + strings.TrimSuffix(strings.SplitN(c.server, "://", 2)[1], "/") + ":",
+	}
+}
+
+/*
+Check out the commit of a build in a git work tree in a temporary directory, and return the directory.
+The commit is first fetched into the bare mirror of the project, which is created when it doesn't exist yet,
+so builds only fetch what changed since the previous build. The work tree is then fetched from the mirror.
+*/
+func checkoutCommit(ctx context.Context, b build, token *oauth2.Token, checkout pipeline.Checkout) (string, error) {
+	if err := CheckGitVersion(); err != nil {
+		return "", err
+	}
+
+	remote, err := b.provider.CloneURL(b.repo, token)
+	if err != nil {
+		return "", fmt.Errorf("Error while constructing clone URL: %v", err)
+	}
+	// Pass the credentials as a header, so they don't end up in the configuration of the mirror or work tree
+	var credentials *gitCredentials
+	if remote.User != nil {
+		password, _ := remote.User.Password()
+		credentials = &gitCredentials{
+			server: fmt.Sprintf("%s://%s/", remote.Scheme, remote.Host),
+			header: "Authorization: Basic " +
+				base64.StdEncoding.EncodeToString([]byte(remote.User.Username()+":"+password)),
+		}
+		remote.User = nil
+	}
+
+	mirrorPath, err := projectMirrorPath(b.provider, b.repo)
+	if err != nil {
+		return "", err
+	}
+	lock := lockMirror(mirrorPath)
+	defer lock.Unlock()
+
+	if common.CheckDirNotExists(mirrorPath) {
+		log.Infof("Creating mirror of %q in %q", b.repo.FullName, mirrorPath)
+		if err := runGit(ctx, "", nil, "init", "--quiet", "--bare", mirrorPath); err != nil {
+			return "", err
+		}
+	}
+
+	// Fetch the commit into a ref of its own, so it can be fetched from the mirror. Not every server allows
+	// fetching a commit by its ID, in which case we fetch the ref the build is for and hope it didn't move on.
+	log.Infof("Fetching commit %s of %q", b.commitID, b.repo.FullName)
+	buildRef := "refs/builds/" + b.commitID
+	fetchArgs := []string{"fetch", "--quiet", "--tags"}
+	if checkout.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(checkout.Depth))
+	} else if _, err := os.Stat(filepath.Join(mirrorPath, "shallow")); err == nil {
+		fetchArgs = append(fetchArgs, "--unshallow")
+	}
+	err = runGit(ctx, mirrorPath, credentials, append(fetchArgs, remote.String(), "+"+b.commitID+":"+buildRef)...)
+	if err != nil && b.ref != "" {
+		log.Debugf("Couldn't fetch commit %s by its ID, fetching %q instead: %v", b.commitID, b.ref, err)
+		err = runGit(ctx, mirrorPath, credentials, append(fetchArgs, remote.String(), b.ref)...)
+		if err == nil {
+			err = runGit(ctx, mirrorPath, nil, "update-ref", buildRef, b.commitID)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error while fetching commit %s: %v", b.commitID, err)
+	}
+	// The ref is also removed when the build was cancelled
+	defer runGit(context.Background(), mirrorPath, nil, "update-ref", "-d", buildRef)
+
+	tmpDir, err := ioutil.TempDir("", tmpDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("Error while creating temporary directory: %v", err)
+	}
+	repoDir := filepath.Join(tmpDir, b.repo.Name)
+
+	log.Infof("Checking out commit %s in %q", b.commitID, repoDir)
+	fetchArgs = []string{"fetch", "--quiet", "--tags"}
+	if checkout.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(checkout.Depth))
+	}
+	if err := runGit(ctx, "", nil, "init", "--quiet", repoDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("Error while checking out commit %s: %v", b.commitID, err)
+	}
+	for _, args := range [][]string{
+		{"remote", "add", "origin", remote.String()},
+		append(fetchArgs, "file://"+mirrorPath, buildRef),
+		{"checkout", "--quiet", "--detach", b.commitID},
+	} {
+		if err := runGit(ctx, repoDir, nil, args...); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", fmt.Errorf("Error while checking out commit %s: %v", b.commitID, err)
+		}
+	}
+
+	if checkout.Submodules {
+		if err := checkoutSubmodules(ctx, repoDir, credentials); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", err
+		}
+	}
+	if checkout.LFS {
+		if err := checkoutLFS(ctx, repoDir, credentials); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", err
+		}
+	}
+
+	return repoDir, nil
+}
+
+// Recursively initialise the submodules of a work tree, and make sure all of them were checked out.
+func checkoutSubmodules(ctx context.Context, repoDir string, credentials *gitCredentials) error {
+	log.Infof("Initialising submodules in %q", repoDir)
+	err := runGit(ctx, repoDir, credentials, "submodule", "update", "--quiet", "--init", "--recursive")
+	if err != nil {
+		return fmt.Errorf("Error while initialising submodules: %v", err)
+	}
+
+	// Submodules that aren't initialised are prefixed with a "-"
+	status, err := outputGit(ctx, repoDir, nil, "submodule", "status", "--recursive")
+	if err != nil {
+		return fmt.Errorf("Error while checking submodules: %v", err)
+	}
+	for _, line := range strings.Split(status, "\n") {
+		if strings.HasPrefix(line, "-") {
+			return fmt.Errorf("Submodule %q wasn't initialised", strings.Fields(line)[1])
+		}
+	}
+
+	return nil
+}
+
+// Fetch the Git LFS objects of a work tree, and make sure no LFS pointers are left in it.
+func checkoutLFS(ctx context.Context, repoDir string, credentials *gitCredentials) error {
+	log.Infof("Fetching LFS objects in %q", repoDir)
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		return errors.New("Error while fetching LFS objects: git-lfs isn't installed")
+	}
+	if err := runGit(ctx, repoDir, credentials, "lfs", "pull"); err != nil {
+		return fmt.Errorf("Error while fetching LFS objects: %v", err)
+	}
+
+	// Files of which only the pointer is present are marked with a "-"
+	files, err := outputGit(ctx, repoDir, nil, "lfs", "ls-files")
+	if err != nil {
+		return fmt.Errorf("Error while checking LFS objects: %v", err)
+	}
+	for _, line := range strings.Split(files, "\n") {
+		if fields := strings.SplitN(line, " ", 3); len(fields) == 3 && fields[1] == "-" {
+			return fmt.Errorf("LFS object of %q wasn't fetched", fields[2])
+		}
+	}
+
+	return nil
+}
+
+// Run a git command in a directory. When credentials are given, git uses them for the server they belong to.
+func runGit(ctx context.Context, dir string, credentials *gitCredentials, args ...string) error {
+	_, err := outputGit(ctx, dir, credentials, args...)
+	return err
+}
+
+// Run a git command in a directory, and return its output.
+func outputGit(ctx context.Context, dir string, credentials *gitCredentials, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never ask for credentials on a terminal, and keep them out of the process list. LFS objects are only
+	// fetched when asked for, by checkoutLFS.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_LFS_SKIP_SMUDGE=1")
+	if credentials != nil {
+		cmd.Env = append(cmd.Env, credentials.env()...)
+	}
+
+	log.Debugf("Running git %s", strings.Join(args, " "))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,91 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"strings"
+)
+
+// SkipMarkers are markers that, besides "[skip ci]" and "[ci skip]", skip a push when the message of its head
+// commit contains one of them.
+var SkipMarkers []string
+
+var defaultSkipMarkers = []string{"[skip ci]", "[ci skip]"}
+
+// Returns the skip marker a commit message contains, or an empty string if it doesn't contain any.
+// Markers are matched case insensitively.
+func skipMarker(message string) string {
+	if message == "" {
+		return ""
+	}
+
+	message = strings.ToLower(message)
+	for _, marker := range append(defaultSkipMarkers, SkipMarkers...) {
+		if marker != "" && strings.Contains(message, strings.ToLower(marker)) {
+			return marker
+		}
+	}
+	return ""
+}
+
+/*
+Decide whether the pipeline configuration of a commit filters out its build. Returns the reason the build is
+skipped, or an empty string if the pipeline runs, and whether the skipped build should be reported as successful.
+*/
+func skipBuild(config pipeline.Pipeline, b build) (string, bool) {
+	if !config.RunsForRef(b.ref) {
+		return fmt.Sprintf("the pipeline isn't configured to run for %q", b.ref), false
+	}
+
+	if !config.RunsForPaths(b.changedPaths) {
+		return "none of the changed paths are relevant to the pipeline", config.Paths.ReportSkipped
+	}
+
+	return "", false
+}
+
+/*
+Decide whether the pipeline configuration of a pushed commit filters out its build, before a job is queued for it.
+Returns the reason the push is skipped, or an empty string if it's built. The commit of a skipped push gets its
+status right away when it should be reported as successful. Pushes of which the configuration can't be read are
+built, so their job reports why.
+*/
+func filterPush(b *build) string {
+	// Without a token the configuration can't be read
+	repoToken := repositoryToken(b.repo.FullName)
+	if repoToken == nil || repoToken.AccessToken == "" || b.commitID == "" {
+		return ""
+	}
+
+	ctx := context.Background()
+	config, err := fetchPipelineConfig(ctx, b, repoToken)
+	if err != nil {
+		log.Debugf("Couldn't read the pipeline configuration of commit %q, not filtering it: %v", b.commitID, err)
+		return ""
+	}
+
+	reason, reportSkipped := skipBuild(config, *b)
+	if reason != "" && reportSkipped {
+		setStatus(ctx, *b, repoToken, "success", "Skipped, "+reason)
+	}
+	return reason
+}
+
+// Fetch and parse the pipeline configuration of a commit through the API of its provider.
+func fetchPipelineConfig(ctx context.Context, b *build, token *oauth2.Token) (pipeline.Pipeline, error) {
+	for _, extension := range []string{".yaml", ".yml"} {
+		pipelineConfigBuf, err := b.provider.FetchFile(ctx, b.repo, token, b.commitID, pipelineFile+extension)
+		if err == ErrFileNotFound {
+			continue
+		} else if err != nil {
+			return pipeline.Pipeline{}, fmt.Errorf("Error while fetching %s%s: %v", pipelineFile, extension, err)
+		}
+		return pipeline.ParseConfig(pipelineConfigBuf)
+	}
+
+	return pipeline.Pipeline{}, errors.New("Couldn't find .octorunner.yaml or .octorunner.yml in repository")
+}
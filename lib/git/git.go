@@ -1,16 +1,13 @@
 package git
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	authentication "github.com/boyvanduuren/octorunner/lib/auth"
 	"github.com/boyvanduuren/octorunner/lib/common"
 	"github.com/boyvanduuren/octorunner/lib/pipeline"
 	"github.com/docker/docker/client"
-	"github.com/google/go-github/github"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"io"
@@ -18,60 +15,85 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"github.com/boyvanduuren/octorunner/lib/persist"
 )
 
 const (
-	eventHeader     = "X-GitHub-Event"
-	forwardedHeader = "X-Forwarded-For"
-	signatureHeader = "X-Hub-Signature"
-	tmpDirPrefix    = "octorunner-"
-	tmpFilePrefix   = "archive-"
-	pipelineFile    = ".octorunner"
-	EnvPrefix       = "octorunner"
-	envRepoToken    = "%s_%s_TOKEN"
-	envRepoSecret   = "%s_%s_SECRET"
+	forwardedHeader      = "X-Forwarded-For"
+	tmpDirPrefix         = "octorunner-"
+	tmpFilePrefix        = "archive-"
+	pipelineFile         = ".octorunner"
+	EnvPrefix            = "octorunner"
+	envRepoToken         = "%s_%s_TOKEN"
+	envRepoSecret        = "%s_%s_SECRET"
+	envRepoRequireSHA256 = "%s_%s_REQUIRE_SHA256"
+	envRepoRequireSig    = "%s_%s_REQUIRE_SIGNATURE"
+	envRepoProvider      = "%s_%s_PROVIDER"
+	envRepoURL           = "%s_%s_URL"
+	envRepoUploadURL     = "%s_%s_UPLOAD_URL"
 )
 
 var Auth authentication.Method
 
+// RequireSignature rejects deliveries for repositories that are unknown or don't have a secret configured.
+// Repositories can also require signatures individually.
+var RequireSignature bool
+
 const repositoryData string = "repositoryData"
 
-type hookPayload struct {
-	Ref, Before, After, Compare string
-	Created, Deleted, Forced    bool
-	Repository                  struct {
-		ID       int
-		Name     string
-		FullName string `json:"full_name"`
-		Owner    struct {
-			Name string `json:"name"`
-		} `json:"owner"`
-		Private bool
-	} `json:"repository"`
-	Pusher struct {
-		Name, Email string
-	} `json:"pusher"`
-	Sender struct {
-		Login string
-		ID    int
-	} `json:"sender"`
+// The context key of the variables a job was created with.
+const jobVariables string = "jobVariables"
+
+// build contains the information needed to download a commit and run its pipeline.
+type build struct {
+	provider Provider
+	repo     Repository
+	// The commit to build, when empty the commit ref points to is looked up when the build is queued
+	commitID    string
+	ref         string
+	pullRequest int
+	// The paths changed by the commits of a push, nil when they're unknown
+	changedPaths []string
+	// Environment variables that are passed to the job
+	variables map[string]string
+	// The name of the job, "default" when it's empty
+	job string
+	// Whether the build was queued by a schedule
+	scheduled bool
+	// Whether the build was queued for a push or pull request delivered by a webhook
+	pushed bool
+	// The branch a pull request was opened from, when it's a branch of the same repository
+	headRef string
 }
 
-// HandleWebhook is called when we receive a request on our listener and is responsible
-// for decoding the payload and passing it to the appropriate handler for that particular event.
-// If the received event is not supported we log an error and return without doing anything.
-func HandleWebhook(w http.ResponseWriter, r *http.Request, v url.Values) {
-	// Map Github webhook events to functions that handle them
-	supportedEvents := map[string]func(hookPayload){
-		"push": handlePush,
-	}
+// Results of verifying the signature of a delivery
+const (
+	signatureUnchecked     = "unchecked"
+	signatureNotConfigured = "no secret configured"
+	signatureMissing       = "missing"
+	signatureInvalid       = "invalid"
+	signatureSHA1Rejected  = "sha1 rejected"
+	signatureValid         = "valid"
+)
 
-	// Return 200 to the client
-	w.WriteHeader(200)
+// webhookResponse is the body we answer accepted deliveries with.
+type webhookResponse struct {
+	Delivery      int64 `json:"delivery"`
+	Job           int64 `json:"job"`
+	QueuePosition int64 `json:"queuePosition,omitempty"`
+}
 
+// HandleWebhook is called when we receive a request on our listener and is responsible
+// for reading the delivery and passing it on to be processed and stored in the delivery log.
+// A delivery that was accepted before refers to the job that was queued back then, only replays can build it again.
+// The response tells the client what was done with the delivery: 202 and the queued job when it was accepted,
+// 200 and the existing job when it was accepted before, 204 when it was ignored, 400 when it couldn't be read,
+// 401 when its signature couldn't be verified, and 5xx when it couldn't be queued.
+func HandleWebhook(w http.ResponseWriter, r *http.Request, v url.Values) {
 	log.Info("Received request on listener")
 	// Request might be proxied, so check if there's an X-Forwarded-For header
 	forwardedFor := r.Header.Get(forwardedHeader)
@@ -83,189 +105,514 @@ func HandleWebhook(w http.ResponseWriter, r *http.Request, v url.Values) {
 	}
 	log.Debug("Request from " + r.UserAgent() + " at " + remoteAddr)
 
-	// Check which event we received and assign the appropriate handler to eventHandler
-	var eventHandler func(hookPayload)
-	event := r.Header.Get(eventHeader)
-	if event == "" {
-		log.Error("Header \"" + eventHeader + "\" not set, returning")
-		return
-	} else if val, exists := supportedEvents[event]; exists {
-		eventHandler = val
-		log.Debug("Found appropriate handler for \"" + event + "\" event")
-	} else {
-		log.Error("Received \"" + eventHeader + "\", but found no supporting handler for \"" +
-			event + "\" event, returning")
-		return
-	}
-
 	// Read the body of the request
 	payloadBody, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
 		log.Errorf("Error while reading payload: %v", err)
+		http.Error(w, fmt.Sprintf("Error while reading payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Debug("Received body ", string(payloadBody))
+
+	// Only replays can be forced to be built again, the query of the payload URL isn't covered by the signature
+	delivery, status := handleDelivery(r.Header, payloadBody, false)
+
+	switch status {
+	case http.StatusOK, http.StatusAccepted:
+		response := webhookResponse{Delivery: delivery.ID, Job: delivery.Job}
+		job, err := persist.DBConn.FindJob(delivery.Job)
+		if err == nil {
+			response.QueuePosition = job.QueuePosition
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	case http.StatusNoContent:
+		w.WriteHeader(status)
+	default:
+		http.Error(w, delivery.Outcome, status)
+	}
+}
+
+/*
+ReplayDelivery processes a delivery from the delivery log again, as if it was just received.
+If the delivery was accepted before, the replay refers to the job that was queued back then,
+unless force is set in which case a new job is queued.
+The replay is stored in the delivery log as a new delivery.
+Returns the new delivery.
+*/
+func ReplayDelivery(id int64, force bool) (*persist.Delivery, error) {
+	delivery, err := persist.DBConn.FindDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Replaying delivery %d (%q)", id, delivery.DeliveryID)
+
+	// GitLab authenticates deliveries by sending the secret of their repository along, which isn't stored. A delivery
+	// that was authenticated by it is replayed with the secret that's configured for its repository now.
+	headers := delivery.Headers
+	if delivery.Signature == signatureValid && headers.Get(gitlabEventHeader) != "" {
+		webhook, err := gitlabProvider{}.ParseWebhook(delivery.Event, []byte(delivery.Body))
+		if err == nil {
+			if repoSecret := repositorySecret(webhook.Repository.FullName); len(repoSecret) > 0 {
+				headers.Set(gitlabTokenHeader, string(repoSecret))
+			}
+		}
+	}
+
+	replay, _ := handleDelivery(headers, []byte(delivery.Body), force)
+	return &replay, nil
+}
+
+// Process a delivery and store it in the delivery log, together with what was done with it.
+// Returns the stored delivery and the HTTP status code that describes what was done with it.
+func handleDelivery(headers http.Header, payloadBody []byte, force bool) (persist.Delivery, int) {
+	delivery := persist.Delivery{
+		Headers:   headers,
+		Body:      string(payloadBody),
+		Signature: signatureUnchecked,
+		Received:  time.Now(),
+	}
+
+	provider := detectProvider(headers)
+	var status int
+	if provider == nil {
+		log.Error("Couldn't determine which provider sent the delivery, returning")
+		delivery.Outcome = "Rejected, couldn't determine which provider sent the delivery"
+		status = http.StatusBadRequest
 	} else {
-		log.Debug("Received body ", string(payloadBody))
+		delivery.DeliveryID = provider.DeliveryID(headers)
+		delivery.Event = provider.Event(headers)
+		status = processDelivery(provider, &delivery, payloadBody, force)
 	}
+	log.Infof("Delivery %q: %s", delivery.DeliveryID, delivery.Outcome)
 
-	// Try to decode the payload
-	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
-	var payload hookPayload
-	err = jsonDecoder.Decode(&payload)
+	// Headers that contain secrets are neither stored nor returned
+	delivery.Headers = persist.RedactHeaders(headers)
+	id, err := persist.DBConn.CreateDelivery(delivery)
 	if err != nil {
+		log.Errorf("Error while storing delivery %q: %v", delivery.DeliveryID, err)
+	}
+	delivery.ID = id
+
+	return delivery, status
+}
+
+// Decode the payload of a delivery, verify its signature and queue a build if the delivery asks for one.
+// The result of the signature verification and the outcome are set on the delivery.
+// If the received event is not supported we log an error and return without doing anything.
+// Unless force is set, a delivery that was accepted before refers to the job that was queued back then.
+// Returns the HTTP status code that describes the outcome.
+func processDelivery(provider Provider, delivery *persist.Delivery, payloadBody []byte, force bool) int {
+	webhook, err := provider.ParseWebhook(delivery.Event, payloadBody)
+	if err == ErrUnsupportedEvent {
+		log.Errorf("Found no supporting handler for %q event of provider %q, returning", delivery.Event,
+			provider.Name())
+		delivery.Outcome = fmt.Sprintf("Ignored, %q events aren't supported", delivery.Event)
+		return http.StatusNoContent
+	} else if err != nil {
 		log.Error("Error while decoding payload: ", err)
-		return
+		delivery.Outcome = fmt.Sprintf("Rejected, error while decoding payload: %v", err)
+		return http.StatusBadRequest
+	}
+	repoFullName := webhook.Repository.FullName
+
+	// A repository can only receive deliveries from the provider that hosts it
+	if configured := providerConfig(repoFullName).Provider; configured != "" && configured != provider.Name() {
+		log.Errorf("Received delivery from %q, but %q is hosted by %q", provider.Name(), repoFullName, configured)
+		delivery.Outcome = fmt.Sprintf("Rejected, %q is hosted by %q but the delivery was sent by %q",
+			repoFullName, configured, provider.Name())
+		return http.StatusBadRequest
 	}
-	log.Debug("Decoded payload to ", payload)
 
 	// The repository that this payload is for might have a secret configured, in which case we expect
 	// a signature with the payload. The given signature then needs to match a signature we calculate ourselves.
 	// Only then will we call our handler, else we'll log an error and return
-	repoSecret := Auth.RequestSecret(payload.Repository.FullName)
+	repoSecret := repositorySecret(repoFullName)
 	if len(repoSecret) == 0 {
-		// We need to manually search the env, because viper doesn't seem to load these
-		// environment vars into the config.
-		repoSecretEnvKey := fmt.Sprintf(envRepoSecret, strings.ToUpper(EnvPrefix), payload.Repository.FullName)
-		log.Debugf("Couldn't find secret in config file, looking if environment var %q exists", repoSecretEnvKey)
-		repoSecret = []byte(os.Getenv(repoSecretEnvKey))
-		if len(repoSecret) == 0 {
-			log.Error("No secret was configured, cannot verify their signature")
-		} else {
-			log.Debugf("Found secret for %q in environment", payload.Repository.FullName)
-			signature := r.Header.Get(signatureHeader)
-			if signature == "" {
-				log.Error("Expected signature for payload, but none given")
-				return
-			}
-			log.Debug("Received signature " + signature)
-			calculatedSignature := "sha1=" + authentication.CalculateSignature(repoSecret, payloadBody)
-			log.Debug("Calculated signature ", calculatedSignature)
-			if !authentication.CompareSignatures([]byte(signature), []byte(calculatedSignature)) {
-				log.Error("Signatures didn't match")
-				return
-			}
+		delivery.Signature = signatureNotConfigured
+		policy := signaturePolicy(repoFullName)
+		if RequireSignature && repositoryToken(repoFullName) == nil {
+			log.Warnf("Rejected delivery for unknown repository %q, signatures are required", repoFullName)
+			delivery.Outcome = fmt.Sprintf("Rejected, %q is an unknown repository and signatures are required",
+				repoFullName)
+			return http.StatusUnauthorized
+		} else if RequireSignature || policy.RequireSignature {
+			log.Warnf("Rejected delivery for %q, signatures are required but no secret was configured",
+				repoFullName)
+			delivery.Outcome = "Rejected, signatures are required but no secret was configured"
+			return http.StatusUnauthorized
+		}
+		log.Error("No secret was configured, cannot verify their signature")
+	} else {
+		delivery.Signature = provider.VerifySignature(delivery.Headers, payloadBody, repoSecret,
+			signaturePolicy(repoFullName))
+		switch delivery.Signature {
+		case signatureMissing:
+			delivery.Outcome = "Rejected, expected signature for payload, but none given"
+			return http.StatusUnauthorized
+		case signatureSHA1Rejected:
+			delivery.Outcome = "Rejected, a SHA-256 signature is required but only a SHA-1 signature was given"
+			return http.StatusUnauthorized
+		case signatureInvalid:
+			delivery.Outcome = "Rejected, signatures didn't match"
+			return http.StatusUnauthorized
+		}
+	}
+
+	// Github retries deliveries, and deliveries can be redelivered by hand from the webhook settings.
+	// We don't want to build those twice, unless we're asked to.
+	if delivery.DeliveryID != "" && !force {
+		accepted, err := persist.DBConn.FindAcceptedDelivery(delivery.DeliveryID)
+		if err != nil {
+			log.Errorf("Error while looking for earlier deliveries of %q: %v", delivery.DeliveryID, err)
+		} else if accepted != nil {
+			log.Infof("Delivery %q was already accepted as job %d", delivery.DeliveryID, accepted.Job)
+			delivery.Job = accepted.Job
+			delivery.Outcome = fmt.Sprintf("Duplicate of delivery %d, which queued job %d", accepted.ID, accepted.Job)
+			return http.StatusOK
+		}
+	}
+
+	if len(webhook.Others) == 0 {
+		return processWebhook(provider, delivery, webhook)
+	}
+
+	// A push that updated several refs is handled for each of them, the delivery refers to the first job that was
+	// queued. The most significant status is returned, where errors come before queued jobs.
+	webhooks := append([]*Webhook{webhook}, webhook.Others...)
+	outcomes := make([]string, len(webhooks))
+	status := http.StatusNoContent
+	for i, refWebhook := range webhooks {
+		var result persist.Delivery
+		refStatus := processWebhook(provider, &result, refWebhook)
+		outcomes[i] = fmt.Sprintf("%s: %s", refWebhook.Ref, result.Outcome)
+		if delivery.Job == 0 {
+			delivery.Job = result.Job
+		}
+		if statusRank(refStatus) > statusRank(status) {
+			status = refStatus
 		}
 	}
-	go eventHandler(payload)
+	delivery.Outcome = strings.Join(outcomes, "; ")
+	return status
+}
+
+// Ranks the statuses processWebhook returns by how significant they are.
+func statusRank(status int) int {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return 3
+	case status == http.StatusAccepted:
+		return 2
+	case status == http.StatusOK:
+		return 1
+	}
+	return 0
 }
 
-// Handle a push event to a Github repository. We will need to look at the settings for octorunner
-// in this repository and take action accordingly.
-func handlePush(payload hookPayload) {
-	log.Info("Handling received push event")
+// Queue a build for a decoded delivery whose signature was verified, if it asks for one, or cancel the jobs of a
+// deleted ref. The outcome and the queued job are set on the delivery. Returns the HTTP status code that describes
+// the outcome.
+func processWebhook(provider Provider, delivery *persist.Delivery, webhook *Webhook) int {
+	repoFullName := webhook.Repository.FullName
+
+	// Nothing can be built for a deleted ref, but jobs that are still queued or running for it are cancelled
+	if webhook.Deleted {
+		cancelled, err := cancelDeletedRef(provider, webhook.Repository, webhook.Ref)
+		if err != nil {
+			log.Errorf("Error while cancelling jobs for %q: %v", webhook.Ref, err)
+			delivery.Outcome = fmt.Sprintf("Error while cancelling jobs for deleted ref %q: %v", webhook.Ref, err)
+			return http.StatusInternalServerError
+		}
+		delivery.Outcome = fmt.Sprintf("Ignored, %q was deleted", webhook.Ref)
+		if len(cancelled) > 0 {
+			delivery.Outcome += fmt.Sprintf(", cancelled jobs %v", cancelled)
+		}
+		return http.StatusNoContent
+	}
+
+	// Providers decide whether the event should be built, in which case the build is queued
+	if webhook.Ignored != "" {
+		delivery.Outcome = "Ignored, " + webhook.Ignored
+		return http.StatusNoContent
+	}
+	b := &build{
+		provider:     provider,
+		repo:         webhook.Repository,
+		commitID:     webhook.CommitID,
+		ref:          webhook.Ref,
+		pullRequest:  webhook.PullRequest,
+		headRef:      webhook.HeadRef,
+		changedPaths: webhook.ChangedPaths,
+		pushed:       true,
+	}
 
+	// Publishing a release builds the commit its tag points to, unless the push of the tag was built already.
+	// Pushes of tags are delivered before the releases that are published for them.
+	if webhook.Release {
+		if err := resolveCommit(b); err != nil {
+			log.Errorf("Error while queueing build: %v", err)
+			delivery.Outcome = fmt.Sprintf("Error while queueing build: %v", err)
+			return http.StatusInternalServerError
+		}
+		built, err := persist.DBConn.HasJobForCommit(b.repo.Name, b.repo.Owner, b.ref, b.commitID)
+		if err != nil {
+			log.Errorf("Error while looking for jobs of %q: %v", b.ref, err)
+			delivery.Outcome = fmt.Sprintf("Error while looking for jobs of %q: %v", b.ref, err)
+			return http.StatusInternalServerError
+		}
+		if built {
+			delivery.Outcome = fmt.Sprintf("Ignored, commit %s of %q was built for the push of the tag", b.commitID,
+				b.ref)
+			return http.StatusNoContent
+		}
+	}
+
+	// Commits can ask not to be built, we store a skipped job for them so it's visible why nothing ran
+	if marker := skipMarker(webhook.HeadCommitMessage); marker != "" && b.commitID != "" {
+		reason := fmt.Sprintf("the commit message contains %q", marker)
+		jobID, err := persist.DBConn.CreateSkippedJob(b.repo.Name, b.repo.Owner, b.commitID, "default",
+			persist.JobMetadata{PullRequest: int64(b.pullRequest), Ref: b.ref, Provider: b.provider.Name()},
+			"Skipped, "+reason)
+		if err != nil {
+			log.Errorf("Error while storing skipped job: %v", err)
+			delivery.Outcome = fmt.Sprintf("Error while storing skipped job: %v", err)
+			return http.StatusInternalServerError
+		}
+		log.Infof("Skipped job %d for commit %q of %q, %s", jobID, b.commitID, repoFullName, reason)
+		delivery.Job = jobID
+		delivery.Outcome = fmt.Sprintf("Skipped job %d, %s", jobID, reason)
+		return http.StatusOK
+	}
+
+	// The pipeline configuration might filter out the push, in which case no job is created and nothing is cancelled
+	if reason := filterPush(b); reason != "" {
+		log.Debugf("Skipping push of commit %q to %q of %q, %s", b.commitID, b.ref, repoFullName, reason)
+		delivery.Outcome = "Skipped, " + reason
+		return http.StatusNoContent
+	}
+
+	jobID, err := enqueueBuild(b)
+	if err != nil {
+		log.Errorf("Error while queueing build: %v", err)
+		delivery.Outcome = fmt.Sprintf("Error while queueing build: %v", err)
+		if err == ErrQueueFull {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusInternalServerError
+	}
+	delivery.Job = jobID
+	delivery.Outcome = fmt.Sprintf("Queued job %d", jobID)
+
+	// Only a push makes the jobs of earlier pushes to the same ref obsolete
+	if AutoCancel && b.ref != "" {
+		cancelSuperseded(b, jobID)
+	}
+	return http.StatusAccepted
+}
+
+// Look up which signatures a repository accepts, first in the config and then in the environment.
+func signaturePolicy(repoFullName string) authentication.SignaturePolicy {
+	policy := Auth.RequestSignaturePolicy(repoFullName)
+
+	// We need to manually search the env, because viper doesn't seem to load these
+	// environment vars into the config.
+	if !policy.RequireSHA256 {
+		policy.RequireSHA256, _ = strconv.ParseBool(os.Getenv(
+			fmt.Sprintf(envRepoRequireSHA256, strings.ToUpper(EnvPrefix), repoFullName)))
+	}
+	if !policy.RequireSignature {
+		policy.RequireSignature, _ = strconv.ParseBool(os.Getenv(
+			fmt.Sprintf(envRepoRequireSig, strings.ToUpper(EnvPrefix), repoFullName)))
+	}
+
+	return policy
+}
+
+// Look up the secret of a repository, first in the config and then in the environment.
+func repositorySecret(repoFullName string) []byte {
+	repoSecret := Auth.RequestSecret(repoFullName)
+	if len(repoSecret) > 0 {
+		return repoSecret
+	}
+
+	// We need to manually search the env, because viper doesn't seem to load these
+	// environment vars into the config.
+	repoSecretEnvKey := fmt.Sprintf(envRepoSecret, strings.ToUpper(EnvPrefix), repoFullName)
+	log.Debugf("Couldn't find secret in config file, looking if environment var %q exists", repoSecretEnvKey)
+	repoSecret = []byte(os.Getenv(repoSecretEnvKey))
+	if len(repoSecret) > 0 {
+		log.Debugf("Found secret for %q in environment", repoFullName)
+	}
+	return repoSecret
+}
+
+// Look up the token for a repository, first in the config and then in the environment.
+// Returns nil when no token was found.
+func repositoryToken(repoFullName string) *oauth2.Token {
+	repoToken := Auth.RequestToken(repoFullName)
+	if repoToken != nil {
+		return repoToken
+	}
+
+	// We need to manually search the env, because viper doesn't seem to load these
+	// environment vars into the config.
+	repoTokenEnvKey := fmt.Sprintf(envRepoToken, strings.ToUpper(EnvPrefix), repoFullName)
+	log.Debugf("Couldn't find token in config file, looking if environment var %q exists", repoTokenEnvKey)
+	repoTokenEnvVal := os.Getenv(repoTokenEnvKey)
+	if repoTokenEnvVal == "" {
+		return nil
+	}
+	log.Debugf("Found token for %q in environment", repoFullName)
+	return &oauth2.Token{AccessToken: repoTokenEnvVal}
+}
+
+// Download the commit described by a build, run its pipeline as the job with the given ID
+// and set the commit's status accordingly.
+func runBuild(b build, jobID int64) {
 	// Create a context for this request
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	repoFullName := payload.Repository.FullName
-	repoToken := Auth.RequestToken(repoFullName)
+	// Jobs can be cancelled while they run, after which everything that was started for them is cleaned up
+	var workspace string
+	trackJob(jobID, cancel)
+	defer func() {
+		if reason := untrackJob(jobID); reason != "" {
+			finishCancelledJob(b, jobID, workspace, reason)
+		}
+	}()
+	if ctx.Err() != nil {
+		log.Infof("Job %d was cancelled before it started running", jobID)
+		return
+	}
 
-	log.Info("Repository \"" + repoFullName + "\" was pushed to")
+	repoFullName := b.repo.FullName
+	repoToken := repositoryToken(repoFullName)
 
 	// See if we have a token for this repository. If we don't we won't be able to set a status so we abort.
-	// we cannot download the repository from github
+	// we cannot download the repository from the provider
 	if repoToken == nil {
-		// We need to manually search the env, because viper doesn't seem to load these
-		// environment vars into the config.
-		repoTokenEnvKey := fmt.Sprintf(envRepoToken, strings.ToUpper(EnvPrefix), payload.Repository.FullName)
-		log.Debugf("Couldn't find token in config file, looking if environment var %q exists", repoTokenEnvKey)
-		repoTokenEnvVal := os.Getenv(repoTokenEnvKey)
-		if repoTokenEnvVal == "" {
-			log.Errorf("Didn't find token for %q, this means we won't be able to set a status. Aborting.",
-				repoFullName)
-			return
-		}
-		log.Debugf("Found token for %q in environment", repoFullName)
-		repoToken = &oauth2.Token{AccessToken: repoTokenEnvVal}
+		log.Errorf("Didn't find token for %q, this means we won't be able to set a status. Aborting.",
+			repoFullName)
+		failJob(ctx, jobID, fmt.Errorf("No token configured for %q", repoFullName))
+		return
 	}
 
-	repoName := payload.Repository.Name
-	repoOwner := payload.Repository.Owner.Name
-	commitID := payload.After
+	commitID := b.commitID
 
-	/*
-	 When a commit is merged from a branch to another branch, the "after" ID is set to
-	 "0000000000000000000000000000000000000000", and the "previous" ID is the ID of the commit being merged.
-	 That commit will probably already have a state assigned, so we can just return
-	*/
-	if commitID == "0000000000000000000000000000000000000000" {
-		log.Info("Not doing anything, this was a merge commit")
+	// The configuration decides how the source is fetched, so it's read through the API of the provider
+	repoPipeline, err := fetchPipelineConfig(ctx, &b, repoToken)
+	if err != nil {
+		log.Errorf("Error while reading pipeline configuration: %v", err)
+		failJob(ctx, jobID, err)
 		return
 	}
 
-	httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken))
-	gitClient := github.NewClient(httpClient)
+	// Pushes are filtered before they're queued, other builds are filtered once they run, in which case the job
+	// is skipped
+	if reason, reportSkipped := skipBuild(repoPipeline, b); reason != "" {
+		log.Infof("Skipping job %d for %q of %q, %s", jobID, b.ref, repoFullName, reason)
+		err = persist.DBConn.UpdateJobStatus(jobID, persist.STATUS_SKIPPED, "Skipped, "+reason)
+		if err != nil {
+			log.Errorf("Error while updating status of job %d: %v", jobID, err)
+		}
+		if reportSkipped {
+			setStatus(ctx, b, repoToken, "success", "Skipped, "+reason)
+		}
+		return
+	}
 
-	repoDir, err := getRepository(ctx, httpClient, gitClient, repoName, repoOwner, commitID, repoToken)
+	var repoDir string
+	if repoPipeline.Checkout.Mode == pipeline.CheckoutGit {
+		repoDir, err = checkoutCommit(ctx, b, repoToken, repoPipeline.Checkout)
+	} else {
+		repoDir, err = b.provider.FetchSource(ctx, b.repo, repoToken, commitID)
+	}
 	if err != nil {
 		log.Errorf("Error while downloading copy of repository: %v", err)
+		failJob(ctx, jobID, err)
 		return
 	}
+	workspace = filepath.Dir(repoDir)
 
-	ctx = context.WithValue(ctx, repositoryData, map[string]string{
+	repoData := map[string]string{
 		"fullName":   repoFullName,
 		"commitId":   commitID,
 		"fsLocation": repoDir,
-	})
-
-	repoPipeline, err := readPipelineConfig(repoDir)
-	if err != nil {
-		log.Errorf("Error while reading pipeline configuration: %v", err)
-		return
+	}
+	if b.ref != "" {
+		repoData["ref"] = b.ref
+	}
+	if b.pullRequest != 0 {
+		repoData["pullRequest"] = strconv.Itoa(b.pullRequest)
+	}
+	ctx = context.WithValue(ctx, repositoryData, repoData)
+	if len(b.variables) > 0 {
+		ctx = context.WithValue(ctx, jobVariables, b.variables)
 	}
 
 	// set state of commit to pending
 	log.Debug("Setting state to pending")
-	gitSetState(ctx, gitClient, "pending", repoOwner, repoName, commitID)
+	setStatus(ctx, b, repoToken, "pending", "")
 
 	// create Docker client
 	cli, err := client.NewEnvClient()
 	if err != nil {
 		log.Errorf("Error while creating connection to Docker: %q", err)
-		gitSetState(ctx, gitClient, "error", repoOwner, repoName, commitID)
+		failJob(ctx, jobID, err)
+		setStatus(ctx, b, repoToken, "error", "")
 		return
 	}
 	defer cli.Close()
 
-	exitcode, err := repoPipeline.Execute(ctx, cli, &persist.DBConn)
+	exitcode, err := repoPipeline.Execute(ctx, cli, jobStatusWriter{DB: &persist.DBConn, ctx: ctx}, jobID)
 	if err != nil {
 		log.Errorf("Error while executing pipeline: %v", err)
-		gitSetState(ctx, gitClient, "error", repoOwner, repoName, commitID)
+		setStatus(ctx, b, repoToken, "error", "")
 		return
 	}
 
 	log.Debugf("Pipeline returned %d, setting state accordingly", exitcode)
 	if exitcode == 0 {
-		gitSetState(ctx, gitClient, "success", repoOwner, repoName, commitID)
+		setStatus(ctx, b, repoToken, "success", "")
 	} else {
-		gitSetState(ctx, gitClient, "failure", repoOwner, repoName, commitID)
+		setStatus(ctx, b, repoToken, "failure", "")
 	}
 }
 
-func getRepository(ctx context.Context, httpClient *http.Client, gitClient *github.Client, repoName string, repoOwner string,
-	commitID string, repoToken *oauth2.Token) (string, error) {
-	const githubArchiveURL = "https://github.com/%s/%s/archive/%s.zip"
-	const githubArchiveFormat = "zipball"
-	var archiveURL *url.URL
-	var err error
+// jobStatusWriter stores the output and status of a running job, except for the error it runs into when it's cancelled.
+type jobStatusWriter struct {
+	*persist.DB
+	ctx context.Context
+}
 
-	log.Info("Downloading archive of latest commit in push")
-	if repoToken == nil {
-		// no repoToken, so this is a public repository
-		archiveURL, err = url.Parse(fmt.Sprintf(githubArchiveURL, repoOwner, repoName, commitID))
-		if err != nil {
-			return "", fmt.Errorf("Error while constructing archive URL: %v", err)
-		}
-	} else {
-		log.Debug("Getting archive URL for \"" + repoOwner + "/" + repoName + "\", ref \"" + commitID + "\"")
-		archiveURL, _, err = gitClient.Repositories.GetArchiveLink(ctx, repoOwner, repoName, githubArchiveFormat,
-			&github.RepositoryContentGetOptions{Ref: commitID})
-		if err != nil {
-			return "", fmt.Errorf("Error while getting archive URL: %v", err)
-		}
+func (w jobStatusWriter) UpdateJobStatus(jobID int64, status persist.JobStatus, extra string) error {
+	if status == persist.STATUS_ERROR && w.ctx.Err() != nil {
+		log.Debugf("Job %d was cancelled, not setting its status to error", jobID)
+		return nil
+	}
+	return w.DB.UpdateJobStatus(jobID, status, extra)
+}
+
+// Set the status of a job that couldn't be executed to error. Jobs that failed because they were cancelled keep
+// running until finishCancelledJob sets their status.
+func failJob(ctx context.Context, jobID int64, err error) {
+	if ctx.Err() != nil {
+		log.Debugf("Job %d was cancelled, not setting its status to error", jobID)
+		return
+	}
+	updateErr := persist.DBConn.UpdateJobStatus(jobID, persist.STATUS_ERROR, fmt.Sprintf("%v", err))
+	if updateErr != nil {
+		log.Errorf("Error while updating status of job %d: %v", jobID, updateErr)
 	}
-	log.Debug("Found archive URL ", archiveURL)
+}
 
+// Download a zip archive of a repository to a temporary directory, and unpack it there.
+// Returns the directory the repository was unpacked to.
+func downloadArchive(httpClient *http.Client, archiveURL *url.URL) (string, error) {
 	tmpDir, err := ioutil.TempDir("", tmpDirPrefix)
 	if err != nil {
 		log.Error()
@@ -316,30 +663,11 @@ func downloadFile(httpClient *http.Client, url *url.URL, downloadDirectory strin
 	return filePath, nil
 }
 
-func readPipelineConfig(directory string) (pipeline.Pipeline, error) {
-	var pipelineConfig pipeline.Pipeline
-	pipelineConfigPath := path.Join(directory, strings.Join([]string{pipelineFile, ".yaml"}, ""))
-	if _, err := os.Stat(pipelineConfigPath); os.IsNotExist(err) == true {
-		pipelineConfigPath = path.Join(directory, strings.Join([]string{pipelineFile, ".yml"}, ""))
-		if _, err := os.Stat(pipelineConfigPath); os.IsNotExist(err) == true {
-			return pipelineConfig, errors.New("Couldn't find .octorunner.yaml or .octorunner.yml in repository")
-		}
-	}
-	pipelineConfigBuf, err := ioutil.ReadFile(pipelineConfigPath)
+// Set the status of the commit a build is for, the description is optional. Errors are logged, as there's
+// nothing else we can do about them.
+func setStatus(ctx context.Context, b build, token *oauth2.Token, state string, description string) {
+	err := b.provider.SetStatus(ctx, b.repo, token, b.commitID, state, description)
 	if err != nil {
-		return pipelineConfig, fmt.Errorf("Error while reading from %s: %v", pipelineConfigPath, err)
+		log.Errorf("Error while setting state of commit %q to %q: %v", b.commitID, state, err)
 	}
-
-	pipelineConfig, err = pipeline.ParseConfig(pipelineConfigBuf)
-	return pipelineConfig, err
-}
-
-func gitSetState(ctx context.Context, git *github.Client, state string, owner string, repo string, commit string) {
-	repoStatusContext := "continuous-integration/octorunner"
-	git.Repositories.CreateStatus(ctx, owner, repo, commit,
-		&github.RepoStatus{
-			State:   &state,
-			Context: &repoStatusContext,
-		},
-	)
 }
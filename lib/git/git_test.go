@@ -0,0 +1,1330 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testDbName = "test.db"
+
+// The configuration of the repositories tests use, by their full name.
+var testRepositories = map[string]authentication.Repository{}
+
+func init() {
+	// remove the test db, if it exists
+	os.Remove(testDbName)
+	persist.OpenDatabase(testDbName, &persist.DBConn)
+	Auth = authentication.SimpleAuth{Store: testRepositories}
+}
+
+// Queue a job for a repository directly, without going through a provider.
+func queueTestJob(t *testing.T, repo Repository, commitID string, metadata persist.JobMetadata) int64 {
+	jobID, err := persist.DBConn.EnqueueJob(repo.Name, repo.Owner, commitID, "default", metadata, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobID
+}
+
+// fakeProvider is a Provider that decodes every delivery to the same webhook, and never touches the network.
+type fakeProvider struct {
+	webhook Webhook
+	// Returned by ParseWebhook instead of the webhook when it's set
+	err error
+	// The result of verifying a signature, signatureValid when it's empty
+	signature string
+	// The files of every commit, by their path
+	files map[string]string
+}
+
+var errFakeProvider = errors.New("The fake provider doesn't host any repositories")
+
+func (p fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p fakeProvider) Handles(headers http.Header) bool {
+	return false
+}
+
+func (p fakeProvider) Event(headers http.Header) string {
+	return "push"
+}
+
+func (p fakeProvider) DeliveryID(headers http.Header) string {
+	return ""
+}
+
+func (p fakeProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	webhook := p.webhook
+	return &webhook, nil
+}
+
+func (p fakeProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	if p.signature == "" {
+		return signatureValid
+	}
+	return p.signature
+}
+
+func (p fakeProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	return "", errFakeProvider
+}
+
+func (p fakeProvider) FetchSource(ctx context.Context, repo Repository, token *oauth2.Token,
+	commitID string) (string, error) {
+	return "", errFakeProvider
+}
+
+func (p fakeProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	path string) ([]byte, error) {
+	if file, exists := p.files[path]; exists {
+		return []byte(file), nil
+	}
+	return nil, ErrFileNotFound
+}
+
+func (p fakeProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	state string, description string) error {
+	return nil
+}
+
+func (p fakeProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	return nil, errFakeProvider
+}
+
+func expectJobStatus(t *testing.T, jobID int64, expectedStatus string) {
+	job, err := persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != expectedStatus {
+		t.Errorf("Expected job %d to have status %q, got %q", jobID, expectedStatus, job.Status)
+	}
+}
+
+func TestTriggerBuildInvalidVariable(t *testing.T) {
+	project := persist.Project{Name: "TestTriggerBuild", Owner: "bcd"}
+
+	_, err := TriggerBuild(project, "master", "", map[string]string{"DEPLOY": "true", "1TARGET": "staging"})
+	invalid, isInvalid := err.(InvalidVariableError)
+	if !isInvalid {
+		t.Fatalf("Expected an InvalidVariableError, got %v", err)
+	}
+	if invalid.Name != "1TARGET" {
+		t.Fatalf("Expected the rejected variable to be %q, got %q", "1TARGET", invalid.Name)
+	}
+}
+
+func TestCancelSuperseded(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestCancelSuperseded", Owner: "bcd", Name: "TestCancelSuperseded"}
+	ref := "refs/heads/master"
+
+	earlierPush := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+	sameCommit := queueTestJob(t, repo, "cafebabe", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+	scheduled := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "github", Scheduled: true})
+	triggered := queueTestJob(t, repo, "deadc0de", persist.JobMetadata{Ref: ref, Provider: "github"})
+	otherRef := queueTestJob(t, repo, "deadbeef",
+		persist.JobMetadata{Ref: "refs/heads/develop", Provider: "github", Pushed: true})
+
+	b := &build{provider: githubProvider{}, repo: repo, commitID: "cafebabe", ref: ref, pushed: true}
+	jobID, err := enqueueBuild(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelSuperseded(b, jobID)
+
+	cases := []struct {
+		description    string
+		jobID          int64
+		expectedStatus string
+	}{
+		{"earlier push of another commit", earlierPush, "cancelled"},
+		{"earlier push of the same commit", sameCommit, "queued"},
+		{"scheduled build", scheduled, "queued"},
+		{"triggered build", triggered, "queued"},
+		{"push to another ref", otherRef, "queued"},
+		{"superseding push", jobID, "queued"},
+	}
+
+	for _, c := range cases {
+		job, err := persist.DBConn.FindJob(c.jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != c.expectedStatus {
+			t.Errorf("Expected job of %s to have status %q, got %q", c.description, c.expectedStatus, job.Status)
+		}
+	}
+}
+
+func TestScheduledBuildDoesntSupersede(t *testing.T) {
+	AutoCancel = true
+	defer func() { AutoCancel = false }()
+
+	repo := Repository{FullName: "bcd/TestScheduledBuild", Owner: "bcd", Name: "TestScheduledBuild"}
+	ref := "refs/heads/master"
+	pushed := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+
+	jobID, err := enqueueBuild(&build{provider: githubProvider{}, repo: repo, commitID: "cafebabe", ref: ref,
+		scheduled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJobStatus(t, pushed, "queued")
+	expectJobStatus(t, jobID, "queued")
+}
+
+func TestRetryDoesntSupersede(t *testing.T) {
+	AutoCancel = true
+	defer func() { AutoCancel = false }()
+
+	repo := Repository{FullName: "bcd/TestRetrySupersede", Owner: "bcd", Name: "TestRetrySupersede"}
+	ref := "refs/heads/master"
+	earlierID := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+	err := persist.DBConn.UpdateJobStatus(earlierID, persist.STATUS_ERROR, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	laterID := queueTestJob(t, repo, "cafebabe", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+
+	// Retrying the job of the earlier push doesn't cancel the job of the later one
+	earlier, err := persist.DBConn.FindJob(earlierID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryID, err := RetryJob(*earlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJobStatus(t, laterID, "queued")
+	expectJobStatus(t, retryID, "queued")
+
+	retry, err := persist.DBConn.FindJob(retryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Pushed {
+		t.Fatal("Expected the retried job not to be marked as pushed")
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestRetryJob", Owner: "bcd", Name: "TestRetryJob"}
+	metadata := persist.JobMetadata{Ref: "refs/heads/master", Provider: "github",
+		Variables: map[string]string{"DEPLOY": "true"}}
+	jobID := queueTestJob(t, repo, "deadbeef", metadata)
+
+	// Queued and running jobs can't be retried
+	job, err := persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RetryJob(*job)
+	if err != ErrJobActive {
+		t.Fatalf("Expected error %q when retrying a queued job, got %v", ErrJobActive, err)
+	}
+	err = persist.DBConn.UpdateJobStatus(jobID, persist.STATUS_RUNNING, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RetryJob(*job)
+	if err != ErrJobActive {
+		t.Fatalf("Expected error %q when retrying a running job, got %v", ErrJobActive, err)
+	}
+
+	// A finished job is queued again as its next iteration
+	err = persist.DBConn.UpdateJobStatus(jobID, persist.STATUS_ERROR, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryID, err := RetryJob(*job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retry, err := persist.DBConn.FindJob(retryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Status != "queued" {
+		t.Errorf("Expected status %q, got %q", "queued", retry.Status)
+	}
+	if retry.Iteration != job.Iteration+1 {
+		t.Errorf("Expected iteration %d, got %d", job.Iteration+1, retry.Iteration)
+	}
+	if retry.CommitID != job.CommitID || retry.Job != job.Job || retry.Ref != job.Ref {
+		t.Errorf("Expected commit %q, job %q and ref %q, got %q, %q and %q", job.CommitID, job.Job, job.Ref,
+			retry.CommitID, retry.Job, retry.Ref)
+	}
+	if retry.Variables["DEPLOY"] != "true" {
+		t.Errorf("Expected the variables of the retried job, got %v", retry.Variables)
+	}
+	if retry.QueuePosition == 0 {
+		t.Error("Expected the retried job to be queued")
+	}
+}
+
+func TestCancelDequeuedJob(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestCancelDequeuedJob", Owner: "bcd", Name: "TestCancelDequeuedJob"}
+	jobID := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: "refs/heads/master", Provider: "github"})
+
+	// A worker dequeued the job, but didn't start running it yet. Other tests might have queued jobs before it.
+	for {
+		dequeuedID, err := persist.DBConn.DequeueJob()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dequeuedID == jobID {
+			break
+		}
+		if dequeuedID == -1 {
+			t.Fatalf("Expected job %d to be queued", jobID)
+		}
+	}
+	job, err := persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CancelJob(*job, "alice")
+	if err != nil {
+		t.Fatalf("Expected a dequeued job to be cancelled, got %v", err)
+	}
+
+	// The job is stopped as soon as the worker starts running it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trackJob(jobID, cancel)
+	if ctx.Err() == nil {
+		t.Fatal("Expected the job to be stopped when it started running")
+	}
+	reason := untrackJob(jobID)
+	if reason != "Cancelled by alice" {
+		t.Fatalf("Expected reason %q, got %q", "Cancelled by alice", reason)
+	}
+
+	// Jobs that are done can't be cancelled
+	err = persist.DBConn.UpdateJobStatus(jobID, persist.STATUS_DONE, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = persist.DBConn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cancelJob(*job, "Cancelled")
+	if err != ErrJobNotActive {
+		t.Fatalf("Expected error %q, got %v", ErrJobNotActive, err)
+	}
+	if reason := untrackJob(jobID); reason != "" {
+		t.Fatalf("Expected a failed cancel not to leave the job tracked, got reason %q", reason)
+	}
+}
+
+func TestSkipBuild(t *testing.T) {
+	config, err := pipeline.ParseConfig([]byte(`
+image: alpine:latest
+tags: ignore
+branches:
+  only:
+    - master
+paths:
+  only:
+    - "**/*.go"
+  report_skipped: true
+script:
+  - true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ref                   string
+		changedPaths          []string
+		expectedSkipped       bool
+		expectedReportSkipped bool
+	}{
+		{"refs/heads/master", []string{"lib/git/git.go"}, false, false},
+		// The changed paths are unknown
+		{"refs/heads/master", nil, false, false},
+		{"refs/heads/master", []string{"README.md"}, true, true},
+		{"refs/heads/develop", []string{"lib/git/git.go"}, true, false},
+		{"refs/tags/v1.0.0", nil, true, false},
+		{"refs/pull/1/head", []string{"lib/git/git.go"}, false, false},
+	}
+
+	for _, c := range cases {
+		reason, reportSkipped := skipBuild(config, build{ref: c.ref, changedPaths: c.changedPaths})
+		if (reason != "") != c.expectedSkipped {
+			t.Errorf("Expected skipped %v for %q and %v, got reason %q", c.expectedSkipped, c.ref, c.changedPaths,
+				reason)
+		}
+		if reportSkipped != c.expectedReportSkipped {
+			t.Errorf("Expected report skipped %v for %q and %v, got %v", c.expectedReportSkipped, c.ref,
+				c.changedPaths, reportSkipped)
+		}
+	}
+}
+
+func TestCheckGitVersion(t *testing.T) {
+	cases := []struct {
+		output        string
+		expectedValid bool
+	}{
+		{"git version 2.31.0", true},
+		{"git version 2.39.2", true},
+		{"git version 3.0", true},
+		{"git version 2.32.1 (Apple Git-133)", true},
+		{"git version 2.31.1.windows.1", true},
+		{"git version 2.30.9", false},
+		{"git version 1.8.3.1", false},
+		{"git version", false},
+		{"git version two", false},
+	}
+
+	for _, c := range cases {
+		err := checkGitVersion(c.output)
+		if (err == nil) != c.expectedValid {
+			t.Errorf("Expected valid %v for %q, got %v", c.expectedValid, c.output, err)
+		}
+	}
+}
+
+func TestParseDeletionPayload(t *testing.T) {
+	payload := []byte(`{"ref": "refs/heads/feature", "before": "deadbeef",
+		"after": "0000000000000000000000000000000000000000", "deleted": true, "commits": [],
+		"repository": {"name": "TestParseDeletionPayload", "full_name": "bcd/TestParseDeletionPayload",
+		"owner": {"name": "bcd"}}}`)
+
+	webhook, err := githubProvider{}.ParseWebhook("push", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !webhook.Deleted {
+		t.Fatal("Expected the push to delete its ref")
+	}
+	if webhook.Ref != "refs/heads/feature" {
+		t.Fatalf("Expected ref %q, got %q", "refs/heads/feature", webhook.Ref)
+	}
+	if webhook.CommitID != "" {
+		t.Fatalf("Expected no commit to build, got %q", webhook.CommitID)
+	}
+}
+
+func TestParseTagPayload(t *testing.T) {
+	// The "after" ID of an annotated tag is the ID of the tag object
+	payload := []byte(`{"ref": "refs/tags/v1.0.0", "before": "0000000000000000000000000000000000000000",
+		"after": "7a5e2d4b", "created": true, "commits": [], "head_commit": {"id": "cafebabe", "message": "Release"},
+		"repository": {"name": "TestParseTagPayload", "full_name": "bcd/TestParseTagPayload",
+		"owner": {"name": "bcd"}}}`)
+
+	webhook, err := githubProvider{}.ParseWebhook("push", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectWebhook(t, Webhook{CommitID: "cafebabe", Ref: "refs/tags/v1.0.0", HeadCommitMessage: "Release"}, *webhook)
+}
+
+func TestCancelDeletedRef(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestCancelDeletedRef", Owner: "bcd", Name: "TestCancelDeletedRef"}
+	ref := "refs/heads/feature"
+
+	branchJob := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "github", Pushed: true})
+	pullRequestJob := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: "refs/pull/1/head", PullRequest: 1,
+		HeadRef: ref, Provider: "github", Pushed: true})
+	forkJob := queueTestJob(t, repo, "cafebabe", persist.JobMetadata{Ref: "refs/pull/2/head", PullRequest: 2,
+		Provider: "github", Pushed: true})
+	otherRef := queueTestJob(t, repo, "cafebabe",
+		persist.JobMetadata{Ref: "refs/heads/master", Provider: "github", Pushed: true})
+
+	cancelled, err := cancelDeletedRef(githubProvider{}, repo, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 2 || cancelled[0] != branchJob || cancelled[1] != pullRequestJob {
+		t.Fatalf("Expected jobs %d and %d to be cancelled, got %v", branchJob, pullRequestJob, cancelled)
+	}
+
+	expectJobStatus(t, branchJob, "cancelled")
+	expectJobStatus(t, pullRequestJob, "cancelled")
+	expectJobStatus(t, forkJob, "queued")
+	expectJobStatus(t, otherRef, "queued")
+}
+
+func TestParseBitbucketPush(t *testing.T) {
+	payload := []byte(`{"repository": {"full_name": "bcd/TestParseBitbucketPush"}, "push": {"changes": [
+		{"old": {"type": "branch", "name": "master"},
+		 "new": {"type": "branch", "name": "master", "target": {"hash": "deadbeef", "message": "Fix tests"}}},
+		{"new": {"type": "tag", "name": "v1.0.0", "target": {"hash": "cafebabe", "message": "Release"}}},
+		{"old": {"type": "branch", "name": "feature"}}]}}`)
+
+	webhook, err := bitbucketProvider{}.ParseWebhook("repo:push", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.Repository.Owner != "bcd" || webhook.Repository.Name != "TestParseBitbucketPush" {
+		t.Fatalf("Expected repository %q, got %+v", "bcd/TestParseBitbucketPush", webhook.Repository)
+	}
+
+	expected := []Webhook{
+		{Ref: "refs/heads/master", CommitID: "deadbeef", HeadCommitMessage: "Fix tests"},
+		{Ref: "refs/tags/v1.0.0", CommitID: "cafebabe", HeadCommitMessage: "Release"},
+		{Ref: "refs/heads/feature", Deleted: true},
+	}
+	webhooks := append([]*Webhook{webhook}, webhook.Others...)
+	if len(webhooks) != len(expected) {
+		t.Fatalf("Expected %d refs, got %d", len(expected), len(webhooks))
+	}
+	for i, e := range expected {
+		w := webhooks[i]
+		if w.Ref != e.Ref || w.CommitID != e.CommitID || w.HeadCommitMessage != e.HeadCommitMessage ||
+			w.Deleted != e.Deleted {
+			t.Errorf("Expected ref %d to be %+v, got %+v", i, e, *w)
+		}
+		if w.Repository != webhook.Repository {
+			t.Errorf("Expected ref %d to belong to %+v, got %+v", i, webhook.Repository, w.Repository)
+		}
+	}
+}
+
+func TestParseBitbucketServerWebhook(t *testing.T) {
+	push := []byte(`{"eventKey": "repo:refs_changed", "repository": {"slug": "octorunner", "project": {"key": "BCD"}},
+		"changes": [
+		{"ref": {"id": "refs/heads/master"}, "fromHash": "deadbeef", "toHash": "cafebabe", "type": "UPDATE"},
+		{"ref": {"id": "refs/heads/feature"}, "fromHash": "deadbeef",
+		 "toHash": "0000000000000000000000000000000000000000", "type": "DELETE"}]}`)
+
+	webhook, err := bitbucketServerProvider{}.ParseWebhook("repo:refs_changed", push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRepo := Repository{FullName: "BCD/octorunner", Owner: "BCD", Name: "octorunner"}
+	if webhook.Repository != expectedRepo {
+		t.Fatalf("Expected repository %+v, got %+v", expectedRepo, webhook.Repository)
+	}
+	if webhook.Ref != "refs/heads/master" || webhook.CommitID != "cafebabe" || webhook.Deleted {
+		t.Fatalf("Expected an update of %q to %q, got %+v", "refs/heads/master", "cafebabe", *webhook)
+	}
+	if len(webhook.Others) != 1 {
+		t.Fatalf("Expected 1 other ref, got %d", len(webhook.Others))
+	}
+	if deleted := webhook.Others[0]; deleted.Ref != "refs/heads/feature" || !deleted.Deleted || deleted.CommitID != "" {
+		t.Fatalf("Expected %q to be deleted, got %+v", "refs/heads/feature", *deleted)
+	}
+
+	pullRequest := []byte(`{"eventKey": "pr:opened", "pullRequest": {"id": 7,
+		"fromRef": {"id": "refs/heads/feature", "latestCommit": "cafebabe",
+		 "repository": {"slug": "octorunner", "project": {"key": "BCD"}}},
+		"toRef": {"id": "refs/heads/master", "repository": {"slug": "octorunner", "project": {"key": "BCD"}}}}}`)
+
+	webhook, err = bitbucketServerProvider{}.ParseWebhook("pr:opened", pullRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.Repository != expectedRepo {
+		t.Fatalf("Expected repository %+v, got %+v", expectedRepo, webhook.Repository)
+	}
+	if webhook.Ref != "refs/pull-requests/7/from" || webhook.CommitID != "cafebabe" || webhook.PullRequest != 7 {
+		t.Fatalf("Expected pull request 7 at %q, got %+v", "cafebabe", *webhook)
+	}
+	if webhook.HeadRef != "refs/heads/feature" {
+		t.Fatalf("Expected head ref %q, got %q", "refs/heads/feature", webhook.HeadRef)
+	}
+	if webhook.Ignored != "" {
+		t.Fatalf("Expected the pull request to be built, got %q", webhook.Ignored)
+	}
+}
+
+func TestDetectBitbucketProvider(t *testing.T) {
+	cases := []struct {
+		event            string
+		expectedProvider string
+	}{
+		{"repo:push", "bitbucket"},
+		{"pullrequest:created", "bitbucket"},
+		{"repo:refs_changed", "bitbucket-server"},
+		{"pr:from_ref_updated", "bitbucket-server"},
+		{"diagnostics:ping", "bitbucket-server"},
+	}
+
+	for _, c := range cases {
+		provider := detectProvider(http.Header{bitbucketEventHeader: []string{c.event}})
+		if provider == nil || provider.Name() != c.expectedProvider {
+			t.Errorf("Expected %q to be sent by %q, got %v", c.event, c.expectedProvider, provider)
+		}
+	}
+}
+
+func TestVerifyBitbucketSignature(t *testing.T) {
+	payload := []byte(`{"repository": {"full_name": "bcd/TestVerifyBitbucketSignature"}}`)
+	secret := []byte("secret")
+	signature := "sha256=" + authentication.CalculateSignatureSHA256(secret, payload)
+
+	cases := []struct {
+		signature      string
+		expectedResult string
+	}{
+		{signature, signatureValid},
+		{"sha256=" + authentication.CalculateSignatureSHA256([]byte("other"), payload), signatureInvalid},
+		{"sha1=" + authentication.CalculateSignature(secret, payload), signatureInvalid},
+		{"", signatureMissing},
+	}
+
+	for _, provider := range []Provider{bitbucketProvider{}, bitbucketServerProvider{}} {
+		for _, c := range cases {
+			headers := http.Header{}
+			if c.signature != "" {
+				headers.Set(bitbucketSignatureHeader, c.signature)
+			}
+			result := provider.VerifySignature(headers, payload, secret, authentication.SignaturePolicy{})
+			if result != c.expectedResult {
+				t.Errorf("Expected %q from %q for %q, got %q", c.expectedResult, provider.Name(), c.signature, result)
+			}
+		}
+	}
+}
+
+func TestBitbucketURLs(t *testing.T) {
+	cloud := Repository{FullName: "bcd/TestBitbucketCloud", Owner: "bcd", Name: "TestBitbucketCloud"}
+	proxied := Repository{FullName: "bcd/TestBitbucketProxied", Owner: "bcd", Name: "TestBitbucketProxied"}
+	server := Repository{FullName: "BCD/TestBitbucketServer", Owner: "BCD", Name: "TestBitbucketServer"}
+	unconfigured := Repository{FullName: "BCD/TestBitbucketUnconfigured", Owner: "BCD", Name: "TestBitbucketUnconfigured"}
+	testRepositories[proxied.FullName] = authentication.Repository{Provider: "bitbucket",
+		URL: "https://bitbucket.example.com/"}
+	testRepositories[server.FullName] = authentication.Repository{Provider: "bitbucket-server",
+		URL: "https://git.example.com"}
+
+	cases := []struct {
+		provider         Provider
+		repo             Repository
+		expectedCloneURL string
+	}{
+		{bitbucketProvider{}, cloud, "https://bitbucket.org/bcd/TestBitbucketCloud.git"},
+		{bitbucketProvider{}, proxied, "https://bitbucket.example.com/bcd/TestBitbucketProxied.git"},
+		{bitbucketServerProvider{}, server, "https://git.example.com/scm/bcd/TestBitbucketServer.git"},
+	}
+	for _, c := range cases {
+		cloneURL, err := c.provider.CloneURL(c.repo, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cloneURL.String() != c.expectedCloneURL {
+			t.Errorf("Expected clone URL %q, got %q", c.expectedCloneURL, cloneURL.String())
+		}
+	}
+
+	expectedAPIURL := "https://api.bitbucket.org/2.0/repositories/bcd/TestBitbucketCloud"
+	if apiURL := (bitbucketProvider{}).apiURL(cloud); apiURL != expectedAPIURL {
+		t.Errorf("Expected API URL %q, got %q", expectedAPIURL, apiURL)
+	}
+	expectedAPIURL = "https://bitbucket.example.com/api/2.0/repositories/bcd/TestBitbucketProxied"
+	if apiURL := (bitbucketProvider{}).apiURL(proxied); apiURL != expectedAPIURL {
+		t.Errorf("Expected API URL %q, got %q", expectedAPIURL, apiURL)
+	}
+	expectedAPIURL = "https://git.example.com/rest/api/1.0/projects/BCD/repos/TestBitbucketServer"
+	if apiURL, err := (bitbucketServerProvider{}).apiURL(server); err != nil || apiURL != expectedAPIURL {
+		t.Errorf("Expected API URL %q, got %q (%v)", expectedAPIURL, apiURL, err)
+	}
+
+	// Bitbucket Server is self-hosted, there's no address to fall back to
+	if _, err := (bitbucketServerProvider{}).CloneURL(unconfigured, nil); err == nil {
+		t.Error("Expected an error for a Bitbucket Server repository without a URL")
+	}
+}
+
+func TestProcessDeliveryOfSeveralRefs(t *testing.T) {
+	payload := []byte(`{"repository": {"full_name": "bcd/TestProcessDeliveryOfSeveralRefs"}, "push": {"changes": [
+		{"new": {"type": "branch", "name": "master", "target": {"hash": "deadbeef"}}},
+		{"new": {"type": "branch", "name": "develop", "target": {"hash": "cafebabe"}}},
+		{"old": {"type": "branch", "name": "feature"}}]}}`)
+	delivery := persist.Delivery{Event: "repo:push", Headers: http.Header{}}
+
+	status := processDelivery(bitbucketProvider{}, &delivery, payload, false)
+	if status != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusAccepted, status, delivery.Outcome)
+	}
+	for _, ref := range []string{"refs/heads/master", "refs/heads/develop", "refs/heads/feature"} {
+		if !strings.Contains(delivery.Outcome, ref) {
+			t.Errorf("Expected the outcome to mention %q, got %q", ref, delivery.Outcome)
+		}
+	}
+
+	jobs, err := persist.DBConn.FindActiveJobsForRef("TestProcessDeliveryOfSeveralRefs", "bcd", "refs/heads/develop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].CommitID != "cafebabe" {
+		t.Fatalf("Expected a job for commit %q of %q, got %v", "cafebabe", "refs/heads/develop", jobs)
+	}
+	job, err := persist.DBConn.FindJob(delivery.Job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Ref != "refs/heads/master" || job.CommitID != "deadbeef" {
+		t.Fatalf("Expected the delivery to refer to the job of %q, got the job of %q", "refs/heads/master", job.Ref)
+	}
+}
+
+func TestParseGiteaWebhook(t *testing.T) {
+	push := []byte(`{"ref": "refs/heads/master", "before": "deadbeef", "after": "cafebabe", "total_commits": 1,
+		"commits": [{"id": "cafebabe", "message": "Fix tests [ci skip]", "added": ["a.go"], "modified": ["b.go"]}],
+		"repository": {"name": "octorunner", "full_name": "bcd/octorunner", "owner": {"username": "bcd"}}}`)
+	// Only 1 of the 30 commits of the push was sent, so the changed paths are unknown
+	largePush := []byte(`{"ref": "refs/heads/master", "before": "deadbeef", "after": "cafebabe", "total_commits": 30,
+		"commits": [{"id": "cafebabe", "message": "Fix tests", "added": ["a.go"]}],
+		"repository": {"name": "octorunner", "full_name": "bcd/octorunner", "owner": {"username": "bcd"}}}`)
+	pullRequest := []byte(`{"action": "synchronized", "number": 3,
+		"pull_request": {"head": {"ref": "feature", "sha": "deadc0de", "repo": {"full_name": "bcd/octorunner"}}},
+		"repository": {"name": "octorunner", "full_name": "bcd/octorunner", "owner": {"login": "bcd"}}}`)
+	forkPullRequest := []byte(`{"action": "opened", "number": 4,
+		"pull_request": {"head": {"ref": "feature", "sha": "deadc0de", "repo": {"full_name": "abc/octorunner"}}},
+		"repository": {"name": "octorunner", "full_name": "bcd/octorunner", "owner": {"login": "bcd"}}}`)
+	closedPullRequest := []byte(`{"action": "closed", "number": 3,
+		"pull_request": {"head": {"ref": "feature", "sha": "deadc0de", "repo": {"full_name": "bcd/octorunner"}}},
+		"repository": {"name": "octorunner", "full_name": "bcd/octorunner", "owner": {"login": "bcd"}}}`)
+
+	cases := []struct {
+		event    string
+		payload  []byte
+		expected Webhook
+	}{
+		{"push", push, Webhook{CommitID: "cafebabe", Ref: "refs/heads/master",
+			ChangedPaths: []string{"a.go", "b.go"}, HeadCommitMessage: "Fix tests [ci skip]"}},
+		{"push", largePush, Webhook{CommitID: "cafebabe", Ref: "refs/heads/master", HeadCommitMessage: "Fix tests"}},
+		{"pull_request", pullRequest, Webhook{CommitID: "deadc0de", Ref: "refs/pull/3/head", PullRequest: 3,
+			HeadRef: "refs/heads/feature"}},
+		{"pull_request", forkPullRequest, Webhook{CommitID: "deadc0de", Ref: "refs/pull/4/head", PullRequest: 4}},
+		{"pull_request", closedPullRequest, Webhook{CommitID: "deadc0de", Ref: "refs/pull/3/head", PullRequest: 3,
+			HeadRef: "refs/heads/feature", Ignored: `not doing anything for pull request action "closed"`}},
+	}
+
+	expectedRepo := Repository{FullName: "bcd/octorunner", Owner: "bcd", Name: "octorunner"}
+	for _, c := range cases {
+		webhook, err := giteaProvider{}.ParseWebhook(c.event, c.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if webhook.Repository != expectedRepo {
+			t.Errorf("Expected repository %+v, got %+v", expectedRepo, webhook.Repository)
+		}
+		expectWebhook(t, c.expected, *webhook)
+	}
+
+	if _, err := (giteaProvider{}).ParseWebhook("issues", push); err != ErrUnsupportedEvent {
+		t.Fatalf("Expected ErrUnsupportedEvent, got %v", err)
+	}
+}
+
+// Compare the fields of a webhook that describe what's built, the repository isn't compared.
+func expectWebhook(t *testing.T, expected Webhook, webhook Webhook) {
+	if webhook.CommitID != expected.CommitID || webhook.Ref != expected.Ref ||
+		webhook.PullRequest != expected.PullRequest || webhook.HeadRef != expected.HeadRef ||
+		webhook.HeadCommitMessage != expected.HeadCommitMessage || webhook.Deleted != expected.Deleted ||
+		webhook.Ignored != expected.Ignored {
+		t.Errorf("Expected webhook %+v, got %+v", expected, webhook)
+	}
+	if strings.Join(webhook.ChangedPaths, ",") != strings.Join(expected.ChangedPaths, ",") ||
+		(webhook.ChangedPaths == nil) != (expected.ChangedPaths == nil) {
+		t.Errorf("Expected changed paths %v of %q, got %v", expected.ChangedPaths, expected.Ref, webhook.ChangedPaths)
+	}
+}
+
+func TestVerifyGiteaSignature(t *testing.T) {
+	payload := []byte(`{"ref": "refs/heads/master"}`)
+	secret := []byte("secret")
+
+	cases := []struct {
+		signature      string
+		expectedResult string
+	}{
+		{authentication.CalculateSignatureSHA256(secret, payload), signatureValid},
+		// Gitea doesn't prefix the signature
+		{"sha256=" + authentication.CalculateSignatureSHA256(secret, payload), signatureInvalid},
+		{authentication.CalculateSignatureSHA256([]byte("other"), payload), signatureInvalid},
+		{"", signatureMissing},
+	}
+
+	for _, c := range cases {
+		headers := http.Header{}
+		if c.signature != "" {
+			headers.Set(giteaSignatureHeader, c.signature)
+		}
+		result := giteaProvider{}.VerifySignature(headers, payload, secret, authentication.SignaturePolicy{})
+		if result != c.expectedResult {
+			t.Errorf("Expected %q for %q, got %q", c.expectedResult, c.signature, result)
+		}
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	cases := []struct {
+		headers          http.Header
+		expectedProvider string
+	}{
+		// Gitea also sends the headers Github sends
+		{http.Header{giteaEventHeader: []string{"push"}, eventHeader: []string{"push"}}, "gitea"},
+		{http.Header{eventHeader: []string{"push"}}, "github"},
+	}
+
+	for _, c := range cases {
+		provider := detectProvider(c.headers)
+		if provider == nil || provider.Name() != c.expectedProvider {
+			t.Errorf("Expected %v to be sent by %q, got %v", c.headers, c.expectedProvider, provider)
+		}
+	}
+	if provider := detectProvider(http.Header{}); provider != nil {
+		t.Errorf("Expected no provider to handle a request without event header, got %q", provider.Name())
+	}
+}
+
+func TestParseGitlabWebhook(t *testing.T) {
+	push := []byte(`{"object_kind": "push", "ref": "refs/heads/master", "before": "deadbeef", "after": "cafebabe",
+		"total_commits_count": 1, "commits": [{"id": "cafebabe", "message": "Fix tests", "removed": ["a.go"]}],
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"}}`)
+	// Only 1 of the 25 commits of the push was sent, so the changed paths are unknown
+	largePush := []byte(`{"object_kind": "push", "ref": "refs/heads/master", "before": "deadbeef", "after": "cafebabe",
+		"total_commits_count": 25, "commits": [{"id": "cafebabe", "message": "Fix tests", "removed": ["a.go"]}],
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"}}`)
+	tagPush := []byte(`{"object_kind": "tag_push", "ref": "refs/tags/v1.0.0",
+		"before": "0000000000000000000000000000000000000000", "after": "cafebabe", "total_commits_count": 0, "commits": [],
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"}}`)
+	deletion := []byte(`{"object_kind": "push", "ref": "refs/heads/feature", "before": "deadbeef",
+		"after": "0000000000000000000000000000000000000000", "total_commits_count": 0, "commits": [],
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"}}`)
+	mergeRequest := []byte(`{"object_kind": "merge_request",
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"},
+		"object_attributes": {"iid": 5, "action": "update", "oldrev": "deadbeef", "source_branch": "feature",
+		 "source_project_id": 12, "target_project_id": 12, "last_commit": {"id": "deadc0de"}}}`)
+	labeledMergeRequest := []byte(`{"object_kind": "merge_request",
+		"project": {"name": "Octorunner", "path": "octorunner", "path_with_namespace": "bcd/ci/octorunner"},
+		"object_attributes": {"iid": 5, "action": "update", "source_branch": "feature",
+		 "source_project_id": 13, "target_project_id": 12, "last_commit": {"id": "deadc0de"}}}`)
+
+	cases := []struct {
+		event    string
+		payload  []byte
+		expected Webhook
+	}{
+		{"Push Hook", push, Webhook{CommitID: "cafebabe", Ref: "refs/heads/master", ChangedPaths: []string{"a.go"},
+			HeadCommitMessage: "Fix tests"}},
+		{"Push Hook", largePush, Webhook{CommitID: "cafebabe", Ref: "refs/heads/master",
+			HeadCommitMessage: "Fix tests"}},
+		{"Tag Push Hook", tagPush, Webhook{CommitID: "cafebabe", Ref: "refs/tags/v1.0.0"}},
+		{"Push Hook", deletion, Webhook{Ref: "refs/heads/feature", Deleted: true}},
+		{"Merge Request Hook", mergeRequest, Webhook{CommitID: "deadc0de", Ref: "refs/merge-requests/5/head",
+			PullRequest: 5, HeadRef: "refs/heads/feature"}},
+		{"Merge Request Hook", labeledMergeRequest, Webhook{CommitID: "deadc0de", Ref: "refs/merge-requests/5/head",
+			PullRequest: 5, Ignored: "the merge request was updated without receiving new commits"}},
+	}
+
+	// Projects in subgroups belong to the full path of their group
+	expectedRepo := Repository{FullName: "bcd/ci/octorunner", Owner: "bcd/ci", Name: "octorunner"}
+	for _, c := range cases {
+		webhook, err := gitlabProvider{}.ParseWebhook(c.event, c.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if webhook.Repository != expectedRepo {
+			t.Errorf("Expected repository %+v, got %+v", expectedRepo, webhook.Repository)
+		}
+		expectWebhook(t, c.expected, *webhook)
+	}
+
+	if _, err := (gitlabProvider{}).ParseWebhook("Issue Hook", push); err != ErrUnsupportedEvent {
+		t.Fatalf("Expected ErrUnsupportedEvent, got %v", err)
+	}
+}
+
+func TestVerifyGitlabToken(t *testing.T) {
+	payload := []byte(`{"ref": "refs/heads/master"}`)
+	secret := []byte("secret")
+
+	cases := []struct {
+		token          string
+		expectedResult string
+	}{
+		{"secret", signatureValid},
+		{"other", signatureInvalid},
+		// GitLab sends the secret itself instead of signing the delivery
+		{authentication.CalculateSignatureSHA256(secret, payload), signatureInvalid},
+		{"", signatureMissing},
+	}
+
+	for _, c := range cases {
+		headers := http.Header{}
+		if c.token != "" {
+			headers.Set(gitlabTokenHeader, c.token)
+		}
+		result := gitlabProvider{}.VerifySignature(headers, payload, secret, authentication.SignaturePolicy{})
+		if result != c.expectedResult {
+			t.Errorf("Expected %q for %q, got %q", c.expectedResult, c.token, result)
+		}
+	}
+
+	if provider := detectProvider(http.Header{gitlabEventHeader: []string{"Push Hook"}}); provider == nil ||
+		provider.Name() != "gitlab" {
+		t.Errorf("Expected %q to be sent by %q, got %v", gitlabEventHeader, "gitlab", provider)
+	}
+}
+
+func TestProcessDelivery(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestProcessDelivery", Owner: "bcd", Name: "TestProcessDelivery"}
+	testRepositories[repo.FullName] = authentication.Repository{Secret: "secret"}
+	master := Webhook{Repository: repo, CommitID: "deadbeef", Ref: "refs/heads/master"}
+
+	// The cases are processed in order, and store their delivery like handleDelivery does
+	cases := []struct {
+		description       string
+		provider          fakeProvider
+		deliveryID        string
+		force             bool
+		expectedStatus    int
+		expectedJobStatus string
+		// The delivery that queued the job the delivery is expected to refer to
+		duplicateOf string
+	}{
+		{"push", fakeProvider{webhook: master}, "push", false, http.StatusAccepted, "queued", ""},
+		{"redelivered push", fakeProvider{webhook: master}, "push", false, http.StatusOK, "queued", "push"},
+		{"forced redelivery", fakeProvider{webhook: master}, "push", true, http.StatusAccepted, "queued", ""},
+		{"push of a branch", fakeProvider{webhook: Webhook{Repository: repo, CommitID: "cafebabe",
+			Ref: "refs/heads/feature"}}, "branch", false, http.StatusAccepted, "queued", ""},
+		{"deletion of the branch", fakeProvider{webhook: Webhook{Repository: repo, Ref: "refs/heads/feature",
+			Deleted: true}}, "deletion", false, http.StatusNoContent, "", ""},
+		{"skipped push", fakeProvider{webhook: Webhook{Repository: repo, CommitID: "deadc0de",
+			Ref: "refs/heads/master", HeadCommitMessage: "Fix typo [ci skip]"}}, "skipped", false, http.StatusOK,
+			"skipped", ""},
+		{"ignored pull request", fakeProvider{webhook: Webhook{Repository: repo, CommitID: "deadc0de",
+			Ref: "refs/pull/1/head", PullRequest: 1, Ignored: "the pull request was closed"}}, "ignored", false,
+			http.StatusNoContent, "", ""},
+		{"unsupported event", fakeProvider{err: ErrUnsupportedEvent}, "unsupported", false, http.StatusNoContent,
+			"", ""},
+		{"undecodable payload", fakeProvider{err: errors.New("unexpected EOF")}, "undecodable", false,
+			http.StatusBadRequest, "", ""},
+		{"invalid signature", fakeProvider{webhook: master, signature: signatureInvalid}, "invalid", false,
+			http.StatusUnauthorized, "", ""},
+		{"missing signature", fakeProvider{webhook: master, signature: signatureMissing}, "missing", false,
+			http.StatusUnauthorized, "", ""},
+	}
+
+	jobs := make(map[string]int64)
+	for _, c := range cases {
+		delivery := persist.Delivery{DeliveryID: c.deliveryID, Event: "push", Headers: http.Header{}}
+		status := processDelivery(c.provider, &delivery, []byte("{}"), c.force)
+		if _, err := persist.DBConn.CreateDelivery(delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		if status != c.expectedStatus {
+			t.Errorf("Expected status %d for %s, got %d (%s)", c.expectedStatus, c.description, status,
+				delivery.Outcome)
+		}
+		if c.expectedJobStatus == "" {
+			if delivery.Job != 0 {
+				t.Errorf("Expected no job for %s, got job %d", c.description, delivery.Job)
+			}
+			continue
+		}
+		if delivery.Job == 0 {
+			t.Errorf("Expected a job for %s, got none (%s)", c.description, delivery.Outcome)
+			continue
+		}
+		expectJobStatus(t, delivery.Job, c.expectedJobStatus)
+		if c.duplicateOf != "" && delivery.Job != jobs[c.duplicateOf] {
+			t.Errorf("Expected %s to refer to job %d, got %d", c.description, jobs[c.duplicateOf], delivery.Job)
+		}
+		if c.duplicateOf == "" {
+			for deliveryID, jobID := range jobs {
+				if jobID == delivery.Job {
+					t.Errorf("Expected a new job for %s, got the job of delivery %q", c.description, deliveryID)
+				}
+			}
+			jobs[c.deliveryID] = delivery.Job
+		}
+	}
+
+	// The deletion of the branch cancelled its job
+	expectJobStatus(t, jobs["branch"], "cancelled")
+}
+
+func TestProcessDeliveryFilteredPush(t *testing.T) {
+	AutoCancel = true
+	defer func() { AutoCancel = false }()
+
+	repo := Repository{FullName: "bcd/TestProcessDeliveryFiltered", Owner: "bcd", Name: "TestProcessDeliveryFiltered"}
+	testRepositories[repo.FullName] = authentication.Repository{Token: "token"}
+	files := map[string]string{".octorunner.yaml": `
+image: alpine:latest
+branches:
+  except:
+    - gh-pages
+paths:
+  except:
+    - "docs/**"
+script:
+  - true
+`}
+	ref := "refs/heads/master"
+	running := queueTestJob(t, repo, "deadbeef", persist.JobMetadata{Ref: ref, Provider: "fake", Pushed: true})
+
+	cases := []struct {
+		description    string
+		webhook        Webhook
+		expectedStatus int
+	}{
+		{"push that only changes docs", Webhook{Repository: repo, CommitID: "cafebabe", Ref: ref,
+			ChangedPaths: []string{"docs/index.md"}}, http.StatusNoContent},
+		{"push to an excluded branch", Webhook{Repository: repo, CommitID: "cafebabe", Ref: "refs/heads/gh-pages"},
+			http.StatusNoContent},
+		{"push that changes code", Webhook{Repository: repo, CommitID: "deadc0de", Ref: ref,
+			ChangedPaths: []string{"main.go"}}, http.StatusAccepted},
+	}
+
+	for _, c := range cases {
+		// Filtered pushes neither create a job, nor cancel the job of the earlier push
+		expectJobStatus(t, running, "queued")
+
+		delivery := persist.Delivery{Event: "push", Headers: http.Header{}}
+		status := processDelivery(fakeProvider{webhook: c.webhook, files: files}, &delivery, []byte("{}"), false)
+		if status != c.expectedStatus {
+			t.Fatalf("Expected status %d for %s, got %d (%s)", c.expectedStatus, c.description, status,
+				delivery.Outcome)
+		}
+		if (delivery.Job != 0) != (status == http.StatusAccepted) {
+			t.Fatalf("Expected a job only for a push that's built, got job %d for %s", delivery.Job, c.description)
+		}
+	}
+
+	jobs, err := persist.DBConn.FindActiveJobsForRef(repo.Name, repo.Owner, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].CommitID != "deadc0de" {
+		t.Fatalf("Expected only the job of commit %q to be active, got %v", "deadc0de", jobs)
+	}
+	expectJobStatus(t, running, "cancelled")
+}
+
+// Send a Github delivery to HandleWebhook, and return the response.
+func sendWebhook(headers http.Header, payload []byte, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/"+query, bytes.NewReader(payload))
+	r.Header = headers
+	w := httptest.NewRecorder()
+	HandleWebhook(w, r, r.URL.Query())
+	return w
+}
+
+// Returns the payload of a Github push of a commit to the master branch of a repository.
+func githubPushPayload(repo Repository, commitID string) []byte {
+	return []byte(`{"ref": "refs/heads/master", "before": "0000000000000000000000000000000000000001", ` +
+		`"after": "` + commitID + `", "repository": {"name": "` + repo.Name + `", "full_name": "` + repo.FullName +
+		`", "owner": {"name": "` + repo.Owner + `"}}}`)
+}
+
+// Decode the response to an accepted delivery.
+func decodeWebhookResponse(t *testing.T, w *httptest.ResponseRecorder) webhookResponse {
+	var response webhookResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Expected a JSON response, got %q: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestHandleWebhookDuplicateDelivery(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestHandleWebhookDuplicate", Owner: "bcd", Name: "TestHandleWebhookDuplicate"}
+	headers := http.Header{eventHeader: []string{"push"}, deliveryHeader: []string{"TestHandleWebhookDuplicate"}}
+	payload := githubPushPayload(repo, "deadbeef")
+
+	w := sendWebhook(headers, payload, "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	first := decodeWebhookResponse(t, w)
+
+	accepted, err := persist.DBConn.FindAcceptedDelivery("TestHandleWebhookDuplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted == nil || accepted.ID != first.Delivery || accepted.Job != first.Job {
+		t.Fatalf("Expected delivery %d of job %d to be accepted, got %+v", first.Delivery, first.Job, accepted)
+	}
+
+	// A redelivery refers to the job that was queued for the first delivery
+	w = sendWebhook(headers, payload, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	duplicate := decodeWebhookResponse(t, w)
+	if duplicate.Job != first.Job {
+		t.Fatalf("Expected the redelivery to refer to job %d, got %d", first.Job, duplicate.Job)
+	}
+	if duplicate.Delivery == first.Delivery {
+		t.Fatal("Expected the redelivery to be stored as a delivery of its own")
+	}
+
+	// The payload URL can't force a redelivery to be built again, as the query isn't signed
+	w = sendWebhook(headers, payload, "?force=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if unforced := decodeWebhookResponse(t, w); unforced.Job != first.Job {
+		t.Fatalf("Expected the redelivery to refer to job %d, got %d", first.Job, unforced.Job)
+	}
+
+	// Only a replay can
+	forced, err := ReplayDelivery(first.Delivery, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forced.Job == 0 || forced.Job == first.Job {
+		t.Fatalf("Expected a forced replay to queue a new job, got job %d", forced.Job)
+	}
+	job, err := persist.DBConn.FindJob(forced.Job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Iteration != 2 {
+		t.Fatalf("Expected the forced job to be iteration 2, got %d", job.Iteration)
+	}
+}
+
+func TestHandleWebhookStatus(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestHandleWebhookStatus", Owner: "bcd", Name: "TestHandleWebhookStatus"}
+	signed := Repository{FullName: "bcd/TestHandleWebhookSigned", Owner: "bcd", Name: "TestHandleWebhookSigned"}
+	testRepositories[signed.FullName] = authentication.Repository{Secret: "secret"}
+	closedPullRequest := []byte(`{"action": "closed", "number": 1,
+		"pull_request": {"head": {"ref": "feature", "sha": "deadbeef"}},
+		"repository": {"name": "TestHandleWebhookStatus", "full_name": "bcd/TestHandleWebhookStatus",
+		"owner": {"login": "bcd"}}}`)
+
+	cases := []struct {
+		description    string
+		headers        http.Header
+		payload        []byte
+		expectedStatus int
+	}{
+		{"push", http.Header{eventHeader: []string{"push"}}, githubPushPayload(repo, "deadbeef"),
+			http.StatusAccepted},
+		{"closed pull request", http.Header{eventHeader: []string{"pull_request"}}, closedPullRequest,
+			http.StatusNoContent},
+		{"unsupported event", http.Header{eventHeader: []string{"issues"}}, githubPushPayload(repo, "deadbeef"),
+			http.StatusNoContent},
+		{"undecodable payload", http.Header{eventHeader: []string{"push"}}, []byte(`{"ref": `),
+			http.StatusBadRequest},
+		{"unknown provider", http.Header{}, githubPushPayload(repo, "deadbeef"), http.StatusBadRequest},
+		{"invalid signature", http.Header{eventHeader: []string{"push"},
+			signature256Header: []string{"sha256=" + authentication.CalculateSignatureSHA256([]byte("other"),
+				githubPushPayload(signed, "deadbeef"))}}, githubPushPayload(signed, "deadbeef"),
+			http.StatusUnauthorized},
+		{"missing signature", http.Header{eventHeader: []string{"push"}}, githubPushPayload(signed, "deadbeef"),
+			http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		w := sendWebhook(c.headers, c.payload, "")
+		if w.Code != c.expectedStatus {
+			t.Errorf("Expected status %d for %s, got %d: %s", c.expectedStatus, c.description, w.Code,
+				w.Body.String())
+			continue
+		}
+
+		switch w.Code {
+		case http.StatusAccepted:
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON response for %s, got %q", c.description, contentType)
+			}
+			response := decodeWebhookResponse(t, w)
+			if response.Delivery <= 0 || response.Job <= 0 || response.QueuePosition <= 0 {
+				t.Errorf("Expected the delivery, job and queue position for %s, got %+v", c.description, response)
+			}
+		case http.StatusNoContent:
+			if w.Body.Len() != 0 {
+				t.Errorf("Expected no body for %s, got %q", c.description, w.Body.String())
+			}
+		default:
+			// Rejected deliveries are answered with their outcome
+			if !strings.HasPrefix(w.Body.String(), "Rejected") {
+				t.Errorf("Expected the rejection of %s to be explained, got %q", c.description, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestHandleWebhookSignatures(t *testing.T) {
+	repo := Repository{FullName: "bcd/TestHandleWebhookSHA256", Owner: "bcd", Name: "TestHandleWebhookSHA256"}
+	strict := Repository{FullName: "bcd/TestHandleWebhookStrict", Owner: "bcd", Name: "TestHandleWebhookStrict"}
+	testRepositories[repo.FullName] = authentication.Repository{Secret: "secret"}
+	testRepositories[strict.FullName] = authentication.Repository{Secret: "secret", RequireSHA256: true}
+	secret := []byte("secret")
+
+	sign := func(payload []byte, sha256Secret []byte, sha1Secret []byte) http.Header {
+		headers := http.Header{eventHeader: []string{"push"}}
+		if sha256Secret != nil {
+			headers.Set(signature256Header, "sha256="+authentication.CalculateSignatureSHA256(sha256Secret, payload))
+		}
+		if sha1Secret != nil {
+			headers.Set(signatureHeader, "sha1="+authentication.CalculateSignature(sha1Secret, payload))
+		}
+		return headers
+	}
+	payload := githubPushPayload(repo, "deadbeef")
+	strictPayload := githubPushPayload(strict, "deadbeef")
+	wrong := []byte("other")
+
+	cases := []struct {
+		description    string
+		headers        http.Header
+		payload        []byte
+		expectedStatus int
+	}{
+		{"valid SHA-256 signature", sign(payload, secret, nil), payload, http.StatusAccepted},
+		{"valid SHA-1 signature", sign(payload, nil, secret), payload, http.StatusAccepted},
+		// The SHA-256 signature is preferred, the SHA-1 signature isn't looked at when it's present
+		{"valid SHA-256 and invalid SHA-1 signature", sign(payload, secret, wrong), payload, http.StatusAccepted},
+		{"invalid SHA-256 and valid SHA-1 signature", sign(payload, wrong, secret), payload,
+			http.StatusUnauthorized},
+		{"SHA-1 signature when SHA-256 is required", sign(strictPayload, nil, secret), strictPayload,
+			http.StatusUnauthorized},
+		{"SHA-256 signature when SHA-256 is required", sign(strictPayload, secret, secret), strictPayload,
+			http.StatusAccepted},
+	}
+
+	for _, c := range cases {
+		w := sendWebhook(c.headers, c.payload, "")
+		if w.Code != c.expectedStatus {
+			t.Errorf("Expected status %d for %s, got %d: %s", c.expectedStatus, c.description, w.Code,
+				w.Body.String())
+		}
+	}
+
+	w := sendWebhook(sign(strictPayload, nil, secret), strictPayload, "")
+	if !strings.Contains(w.Body.String(), "SHA-256 signature is required") {
+		t.Errorf("Expected the rejection to explain a SHA-256 signature is required, got %q", w.Body.String())
+	}
+}
+
+func TestHandleWebhookRequireSignature(t *testing.T) {
+	unknown := Repository{FullName: "bcd/TestRequireSignatureUnknown", Owner: "bcd", Name: "TestRequireSignatureUnknown"}
+	unsigned := Repository{FullName: "bcd/TestRequireSignatureUnsigned", Owner: "bcd",
+		Name: "TestRequireSignatureUnsigned"}
+	strict := Repository{FullName: "bcd/TestRequireSignatureStrict", Owner: "bcd", Name: "TestRequireSignatureStrict"}
+	signed := Repository{FullName: "bcd/TestRequireSignatureSigned", Owner: "bcd", Name: "TestRequireSignatureSigned"}
+	testRepositories[unsigned.FullName] = authentication.Repository{Token: "token"}
+	testRepositories[strict.FullName] = authentication.Repository{Token: "token", RequireSignature: true}
+	testRepositories[signed.FullName] = authentication.Repository{Token: "token", Secret: "secret"}
+
+	defer func(requireSignature bool) {
+		RequireSignature = requireSignature
+	}(RequireSignature)
+
+	cases := []struct {
+		requireSignature bool
+		repo             Repository
+		signed           bool
+		expectedStatus   int
+		expectedOutcome  string
+	}{
+		{false, unknown, false, http.StatusAccepted, "Queued job"},
+		{false, unsigned, false, http.StatusAccepted, "Queued job"},
+		{false, strict, false, http.StatusUnauthorized, "Rejected, signatures are required"},
+		{true, unknown, false, http.StatusUnauthorized, "Rejected, \"bcd/TestRequireSignatureUnknown\" is an unknown"},
+		{true, unsigned, false, http.StatusUnauthorized, "Rejected, signatures are required"},
+		{true, signed, false, http.StatusUnauthorized, "Rejected, expected signature"},
+		{true, signed, true, http.StatusAccepted, "Queued job"},
+	}
+
+	for _, c := range cases {
+		RequireSignature = c.requireSignature
+		payload := githubPushPayload(c.repo, "deadbeef")
+		headers := http.Header{eventHeader: []string{"push"}}
+		if c.signed {
+			headers.Set(signature256Header, "sha256="+authentication.CalculateSignatureSHA256([]byte("secret"), payload))
+		}
+
+		delivery, status := handleDelivery(headers, payload, false)
+		if status != c.expectedStatus {
+			t.Errorf("Expected status %d for %q with require_signature %v, got %d (%s)", c.expectedStatus,
+				c.repo.FullName, c.requireSignature, status, delivery.Outcome)
+			continue
+		}
+
+		// Rejections are stored in the delivery log, so they can be looked into
+		stored, err := persist.DBConn.FindDelivery(delivery.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stored.Outcome, c.expectedOutcome) {
+			t.Errorf("Expected the outcome for %q with require_signature %v to start with %q, got %q",
+				c.repo.FullName, c.requireSignature, c.expectedOutcome, stored.Outcome)
+		}
+	}
+}
+
+func TestGitlabDeliveryToken(t *testing.T) {
+	testRepositories["bcd/TestGitlabDeliveryToken"] = authentication.Repository{Provider: "gitlab", Secret: "secret"}
+	headers := http.Header{}
+	headers.Set(gitlabEventHeader, "Push Hook")
+	headers.Set(gitlabDeliveryHeader, "TestGitlabDeliveryToken")
+	headers.Set(gitlabTokenHeader, "secret")
+	payload := []byte(`{"object_kind": "push", "ref": "refs/heads/master", "before": "deadbeef", "after": "cafebabe",
+		"total_commits_count": 0, "commits": [], "project": {"name": "TestGitlabDeliveryToken",
+		"path": "TestGitlabDeliveryToken", "path_with_namespace": "bcd/TestGitlabDeliveryToken"}}`)
+
+	delivery, status := handleDelivery(headers, payload, false)
+	if status != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusAccepted, status, delivery.Outcome)
+	}
+
+	// The token is the secret of the repository, so it's neither stored nor returned
+	stored, err := persist.DBConn.FindDelivery(delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*persist.Delivery{&delivery, stored} {
+		if token := d.Headers.Get(gitlabTokenHeader); token != "" {
+			t.Fatalf("Expected the token not to be stored, got %q", token)
+		}
+		if d.Headers.Get(gitlabEventHeader) != "Push Hook" {
+			t.Fatalf("Expected the other headers to be stored, got %v", d.Headers)
+		}
+	}
+
+	// A replay is verified against the configured secret instead
+	replay, err := ReplayDelivery(delivery.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Signature != signatureValid || replay.Job == 0 || replay.Job == delivery.Job {
+		t.Fatalf("Expected the replay to be verified and to queue a new job, got %+v", replay)
+	}
+	if token := replay.Headers.Get(gitlabTokenHeader); token != "" {
+		t.Fatalf("Expected the token not to be returned for the replay, got %q", token)
+	}
+}
@@ -0,0 +1,243 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	giteaEventHeader     = "X-Gitea-Event"
+	giteaDeliveryHeader  = "X-Gitea-Delivery"
+	giteaSignatureHeader = "X-Gitea-Signature"
+)
+
+// giteaProvider implements Provider for repositories hosted on a Gitea (or Forgejo) instance.
+// The URL of the instance has to be configured for every repository.
+type giteaProvider struct{}
+
+type giteaPayload struct {
+	Ref, Before, After string
+	Commits            []pushCommit `json:"commits"`
+	// The number of commits of a push, of which at most 10 are sent by default
+	TotalCommits int `json:"total_commits"`
+	Repository   struct {
+		Name     string
+		FullName string `json:"full_name"`
+		Owner    struct {
+			Login    string `json:"login"`
+			Username string `json:"username"`
+		} `json:"owner"`
+	} `json:"repository"`
+	// Only set for pull_request events
+	Action      string
+	Number      int
+	PullRequest struct {
+		Head struct {
+			Ref  string
+			Sha  string
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	} `json:"pull_request"`
+}
+
+func (p giteaProvider) Name() string {
+	return "gitea"
+}
+
+// Gitea also sends the headers Github sends, so this provider has to be asked before the Github provider.
+func (p giteaProvider) Handles(headers http.Header) bool {
+	return headers.Get(giteaEventHeader) != ""
+}
+
+func (p giteaProvider) Event(headers http.Header) string {
+	return headers.Get(giteaEventHeader)
+}
+
+func (p giteaProvider) DeliveryID(headers http.Header) string {
+	return headers.Get(giteaDeliveryHeader)
+}
+
+func (p giteaProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	if event != "push" && event != "pull_request" {
+		return nil, ErrUnsupportedEvent
+	}
+
+	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
+	var payload giteaPayload
+	err := jsonDecoder.Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Decoded payload to ", payload)
+
+	owner := payload.Repository.Owner.Login
+	if owner == "" {
+		owner = payload.Repository.Owner.Username
+	}
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: payload.Repository.FullName,
+			Owner:    owner,
+			Name:     payload.Repository.Name,
+		},
+	}
+
+	if event == "push" {
+		log.Info("Repository \"" + payload.Repository.FullName + "\" was pushed to")
+		webhook.CommitID = payload.After
+		webhook.Ref = payload.Ref
+		if payload.TotalCommits == len(payload.Commits) {
+			webhook.ChangedPaths = changedPaths(payload.Commits)
+		}
+		webhook.HeadCommitMessage = commitMessage(payload.Commits, payload.After)
+		if isNullCommit(payload.After) {
+			log.Infof("Ref %q of repository %q was deleted", payload.Ref, payload.Repository.FullName)
+			webhook.CommitID = ""
+			webhook.Deleted = true
+		}
+		return webhook, nil
+	}
+
+	webhook.CommitID = payload.PullRequest.Head.Sha
+	webhook.Ref = fmt.Sprintf("refs/pull/%d/head", payload.Number)
+	webhook.PullRequest = payload.Number
+	if payload.PullRequest.Head.Repo.FullName == payload.Repository.FullName {
+		webhook.HeadRef = pipeline.BranchRefPrefix + payload.PullRequest.Head.Ref
+	}
+	switch payload.Action {
+	case "opened", "synchronized", "reopened":
+		log.Infof("Pull request #%d of %q was %s", payload.Number, payload.Repository.FullName, payload.Action)
+	default:
+		webhook.Ignored = fmt.Sprintf("not doing anything for pull request action %q", payload.Action)
+	}
+
+	return webhook, nil
+}
+
+// Gitea signs deliveries using HMAC-SHA256, and sends the hex encoded signature without a prefix.
+func (p giteaProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	signature := headers.Get(giteaSignatureHeader)
+	if signature == "" {
+		log.Error("Expected signature for payload, but none given")
+		return signatureMissing
+	}
+
+	calculatedSignature := authentication.CalculateSignatureSHA256(repoSecret, payloadBody)
+	log.Debug("Received signature " + signature)
+	log.Debug("Calculated signature ", calculatedSignature)
+	if !authentication.CompareSignatures([]byte(signature), []byte(calculatedSignature)) {
+		log.Error("Signatures didn't match")
+		return signatureInvalid
+	}
+
+	return signatureValid
+}
+
+func (p giteaProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return "", err
+	}
+
+	var refs []struct {
+		Ref    string
+		Object struct {
+			Sha string
+		}
+	}
+	err = apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "GET",
+		fmt.Sprintf("%s/git/refs/%s", apiURL, strings.TrimPrefix(ref, "refs/")), nil, &refs)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range refs {
+		if r.Ref == ref {
+			return r.Object.Sha, nil
+		}
+	}
+
+	return "", fmt.Errorf("Couldn't find ref %q in %q", ref, repo.FullName)
+}
+
+func (p giteaProvider) FetchSource(ctx context.Context, repo Repository, repoToken *oauth2.Token,
+	commitID string) (string, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("Downloading archive of commit " + commitID)
+	archiveURL, err := url.Parse(fmt.Sprintf("%s/archive/%s.zip", apiURL, commitID))
+	if err != nil {
+		return "", fmt.Errorf("Error while constructing archive URL: %v", err)
+	}
+
+	return downloadArchive(oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken)), archiveURL)
+}
+
+func (p giteaProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	path string) ([]byte, error) {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiDownload(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)),
+		fmt.Sprintf("%s/raw/%s?ref=%s", apiURL, path, url.QueryEscape(commitID)))
+}
+
+func (p giteaProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	state string, description string) error {
+	apiURL, err := p.apiURL(repo)
+	if err != nil {
+		return err
+	}
+
+	status := map[string]string{
+		"state":   state,
+		"context": "continuous-integration/octorunner",
+	}
+	if description != "" {
+		status["description"] = description
+	}
+	return apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "POST",
+		fmt.Sprintf("%s/statuses/%s", apiURL, commitID), status, nil)
+}
+
+func (p giteaProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return nil, err
+	}
+	cloneURL, err := url.Parse(fmt.Sprintf("%s/%s/%s.git", baseURL, repo.Owner, repo.Name))
+	if err != nil {
+		return nil, err
+	}
+	// Gitea accepts access tokens as username
+	if token != nil {
+		cloneURL.User = url.User(token.AccessToken)
+	}
+	return cloneURL, nil
+}
+
+// Returns the URL of the API endpoints of a repository.
+func (p giteaProvider) apiURL(repo Repository) (string, error) {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", baseURL, url.PathEscape(repo.Owner), url.PathEscape(repo.Name)), nil
+}
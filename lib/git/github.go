@@ -0,0 +1,398 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	eventHeader        = "X-GitHub-Event"
+	deliveryHeader     = "X-GitHub-Delivery"
+	signatureHeader    = "X-Hub-Signature"
+	signature256Header = "X-Hub-Signature-256"
+	githubDefaultURL   = "https://github.com"
+)
+
+// The base URL and upload URL of the Github Enterprise server that hosts repositories, unless configured
+// otherwise for a repository. When empty, repositories are hosted on github.com.
+var (
+	GithubBaseURL   string
+	GithubUploadURL string
+)
+
+// githubProvider implements Provider for repositories hosted on github.com or a Github Enterprise server.
+type githubProvider struct{}
+
+type hookPayload struct {
+	Ref, Before, After, Compare string
+	Created, Deleted, Forced    bool
+	Repository                  struct {
+		ID       int
+		Name     string
+		FullName string `json:"full_name"`
+		Owner    struct {
+			Name  string `json:"name"`
+			Login string `json:"login"`
+		} `json:"owner"`
+		Private bool
+	} `json:"repository"`
+	Pusher struct {
+		Name, Email string
+	} `json:"pusher"`
+	// Only set for push events
+	Commits    []pushCommit `json:"commits"`
+	HeadCommit *pushCommit  `json:"head_commit"`
+	Sender     struct {
+		Login string
+		ID    int
+	} `json:"sender"`
+	// Only set for pull_request and release events
+	Action      string
+	Number      int
+	PullRequest struct {
+		Head struct {
+			Ref  string
+			Sha  string
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Release struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool
+		Prerelease bool
+	} `json:"release"`
+}
+
+func (p githubProvider) Name() string {
+	return "github"
+}
+
+func (p githubProvider) Handles(headers http.Header) bool {
+	return headers.Get(eventHeader) != ""
+}
+
+func (p githubProvider) Event(headers http.Header) string {
+	return headers.Get(eventHeader)
+}
+
+func (p githubProvider) DeliveryID(headers http.Header) string {
+	return headers.Get(deliveryHeader)
+}
+
+func (p githubProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	// Map Github webhook events to functions that handle them
+	supportedEvents := map[string]func(hookPayload) *Webhook{
+		"push":         handlePush,
+		"pull_request": handlePullRequest,
+		"release":      handleRelease,
+	}
+
+	eventHandler, exists := supportedEvents[event]
+	if !exists {
+		return nil, ErrUnsupportedEvent
+	}
+	log.Debug("Found appropriate handler for \"" + event + "\" event")
+
+	// Try to decode the payload
+	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
+	var payload hookPayload
+	err := jsonDecoder.Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Decoded payload to ", payload)
+
+	return eventHandler(payload), nil
+}
+
+// Verify the signature of a delivery using the repository's secret. A SHA-256 signature is preferred when
+// it's present, a SHA-1 signature is only accepted when the repository doesn't require SHA-256.
+func (p githubProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	var signature, calculatedSignature string
+	if signature = headers.Get(signature256Header); signature != "" {
+		calculatedSignature = "sha256=" + authentication.CalculateSignatureSHA256(repoSecret, payloadBody)
+	} else if signature = headers.Get(signatureHeader); signature != "" {
+		if policy.RequireSHA256 {
+			log.Error("Only a SHA-1 signature was given, but a SHA-256 signature is required")
+			return signatureSHA1Rejected
+		}
+		calculatedSignature = "sha1=" + authentication.CalculateSignature(repoSecret, payloadBody)
+	} else {
+		log.Error("Expected signature for payload, but none given")
+		return signatureMissing
+	}
+
+	log.Debug("Received signature " + signature)
+	log.Debug("Calculated signature ", calculatedSignature)
+	if !authentication.CompareSignatures([]byte(signature), []byte(calculatedSignature)) {
+		log.Error("Signatures didn't match")
+		return signatureInvalid
+	}
+
+	return signatureValid
+}
+
+func (p githubProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	gitClient, err := p.client(repo, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)))
+	if err != nil {
+		return "", err
+	}
+	sha, _, err := gitClient.Repositories.GetCommitSHA1(ctx, repo.Owner, repo.Name, ref, "")
+	return sha, err
+}
+
+func (p githubProvider) FetchSource(ctx context.Context, repo Repository, repoToken *oauth2.Token,
+	commitID string) (string, error) {
+	const githubArchiveURL = "%s/%s/%s/archive/%s.zip"
+	const githubArchiveFormat = "zipball"
+	var archiveURL *url.URL
+	var err error
+
+	httpClient := http.DefaultClient
+	log.Info("Downloading archive of commit " + commitID)
+	if repoToken == nil {
+		// no repoToken, so this is a public repository
+		webURL, _, _ := p.urls(repo)
+		archiveURL, err = url.Parse(fmt.Sprintf(githubArchiveURL, webURL, repo.Owner, repo.Name, commitID))
+		if err != nil {
+			return "", fmt.Errorf("Error while constructing archive URL: %v", err)
+		}
+	} else {
+		httpClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken))
+		var gitClient *github.Client
+		gitClient, err = p.client(repo, httpClient)
+		if err != nil {
+			return "", err
+		}
+		log.Debug("Getting archive URL for \"" + repo.FullName + "\", ref \"" + commitID + "\"")
+		archiveURL, _, err = gitClient.Repositories.GetArchiveLink(ctx, repo.Owner, repo.Name, githubArchiveFormat,
+			&github.RepositoryContentGetOptions{Ref: commitID})
+		if err != nil {
+			return "", fmt.Errorf("Error while getting archive URL: %v", err)
+		}
+	}
+	log.Debug("Found archive URL ", archiveURL)
+
+	return downloadArchive(httpClient, archiveURL)
+}
+
+func (p githubProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	path string) ([]byte, error) {
+	httpClient := http.DefaultClient
+	if token != nil {
+		httpClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(token))
+	}
+	gitClient, err := p.client(repo, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	fileContent, _, resp, err := gitClient.Repositories.GetContents(ctx, repo.Owner, repo.Name, path,
+		&github.RepositoryContentGetOptions{Ref: commitID})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fileContent == nil {
+		return nil, fmt.Errorf("%q isn't a file", path)
+	}
+
+	content, err := fileContent.GetContent()
+	return []byte(content), err
+}
+
+func (p githubProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	state string, description string) error {
+	gitClient, err := p.client(repo, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)))
+	if err != nil {
+		return err
+	}
+	repoStatusContext := "continuous-integration/octorunner"
+	repoStatus := &github.RepoStatus{
+		State:   &state,
+		Context: &repoStatusContext,
+	}
+	if description != "" {
+		repoStatus.Description = &description
+	}
+	_, _, err = gitClient.Repositories.CreateStatus(ctx, repo.Owner, repo.Name, commitID, repoStatus)
+	return err
+}
+
+/*
+GithubAPIURL returns the base URL of the API of the Github Enterprise server set in GithubBaseURL,
+or an empty string when repositories are hosted on github.com.
+*/
+func GithubAPIURL() string {
+	if GithubBaseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(GithubBaseURL, "/"), "/api/v3") + "/api/v3/"
+}
+
+func (p githubProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	webURL, _, _ := p.urls(repo)
+	cloneURL, err := url.Parse(fmt.Sprintf("%s/%s/%s.git", webURL, repo.Owner, repo.Name))
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		cloneURL.User = url.UserPassword("x-access-token", token.AccessToken)
+	}
+	return cloneURL, nil
+}
+
+// Create a Github client for the server hosting a repository.
+func (p githubProvider) client(repo Repository, httpClient *http.Client) (*github.Client, error) {
+	gitClient := github.NewClient(httpClient)
+	webURL, baseURL, uploadURL := p.urls(repo)
+	if webURL == githubDefaultURL {
+		return gitClient, nil
+	}
+
+	var err error
+	if gitClient.BaseURL, err = url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("Invalid Github base URL %q: %v", baseURL, err)
+	}
+	if gitClient.UploadURL, err = url.Parse(uploadURL); err != nil {
+		return nil, fmt.Errorf("Invalid Github upload URL %q: %v", uploadURL, err)
+	}
+	return gitClient, nil
+}
+
+/*
+Returns the address of the server hosting a repository, and the base URL and upload URL of its API. The URLs
+configured for the repository take precedence over GithubBaseURL and GithubUploadURL. A base URL can either be
+the address of a Github Enterprise server, or the address of its API. In the former case the API is expected
+at its default location.
+*/
+func (p githubProvider) urls(repo Repository) (webURL string, baseURL string, uploadURL string) {
+	config := providerConfig(repo.FullName)
+	baseURL, uploadURL = config.URL, config.UploadURL
+	if baseURL == "" {
+		baseURL = GithubBaseURL
+	}
+	if uploadURL == "" {
+		uploadURL = GithubUploadURL
+	}
+	if baseURL == "" {
+		return githubDefaultURL, "", ""
+	}
+
+	webURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/api/v3")
+	baseURL = webURL + "/api/v3/"
+	if uploadURL == "" {
+		uploadURL = webURL + "/api/uploads/"
+	} else if !strings.HasSuffix(uploadURL, "/") {
+		uploadURL += "/"
+	}
+	return webURL, baseURL, uploadURL
+}
+
+// Handle a push event to a Github repository. We will need to look at the settings for octorunner
+// in this repository and take action accordingly.
+func handlePush(payload hookPayload) *Webhook {
+	log.Info("Handling received push event")
+	if strings.HasPrefix(payload.Ref, pipeline.TagRefPrefix) {
+		log.Infof("Tag %q was pushed to repository %q", strings.TrimPrefix(payload.Ref, pipeline.TagRefPrefix),
+			payload.Repository.FullName)
+	} else {
+		log.Info("Repository \"" + payload.Repository.FullName + "\" was pushed to")
+	}
+
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: payload.Repository.FullName,
+			Owner:    payload.Repository.Owner.Name,
+			Name:     payload.Repository.Name,
+		},
+		CommitID:     payload.After,
+		Ref:          payload.Ref,
+		ChangedPaths: changedPaths(payload.Commits),
+	}
+	if payload.HeadCommit != nil {
+		webhook.HeadCommitMessage = payload.HeadCommit.Message
+		// The "after" ID of an annotated tag is the ID of the tag object, instead of the commit it points to
+		if strings.HasPrefix(payload.Ref, pipeline.TagRefPrefix) && payload.HeadCommit.ID != "" {
+			webhook.CommitID = payload.HeadCommit.ID
+		}
+	}
+
+	// When a ref is deleted, the "after" ID is set to "0000000000000000000000000000000000000000"
+	if payload.Deleted || isNullCommit(payload.After) {
+		log.Infof("Ref %q of repository %q was deleted", payload.Ref, payload.Repository.FullName)
+		webhook.CommitID = ""
+		webhook.Deleted = true
+	}
+
+	return webhook
+}
+
+// Handle a pull request event on a Github repository. Only pull requests that were opened, reopened or
+// received new commits are built, in which case the head commit of the pull request gets a status.
+func handlePullRequest(payload hookPayload) *Webhook {
+	log.Info("Handling received pull_request event")
+
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: payload.Repository.FullName,
+			Owner:    payload.Repository.Owner.Login,
+			Name:     payload.Repository.Name,
+		},
+		CommitID:    payload.PullRequest.Head.Sha,
+		Ref:         fmt.Sprintf("refs/pull/%d/head", payload.Number),
+		PullRequest: payload.Number,
+	}
+	if payload.PullRequest.Head.Repo.FullName == payload.Repository.FullName {
+		webhook.HeadRef = pipeline.BranchRefPrefix + payload.PullRequest.Head.Ref
+	}
+
+	switch payload.Action {
+	case "opened", "synchronize", "reopened":
+		log.Infof("Pull request #%d of %q was %s", payload.Number, payload.Repository.FullName, payload.Action)
+	default:
+		webhook.Ignored = fmt.Sprintf("not doing anything for pull request action %q", payload.Action)
+	}
+
+	return webhook
+}
+
+// Handle a release event on a Github repository. When a release is published we build the commit
+// its tag points to, the same way we would when that tag was pushed.
+func handleRelease(payload hookPayload) *Webhook {
+	log.Info("Handling received release event")
+
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: payload.Repository.FullName,
+			Owner:    payload.Repository.Owner.Login,
+			Name:     payload.Repository.Name,
+		},
+		Ref:     pipeline.TagRefPrefix + payload.Release.TagName,
+		Release: true,
+	}
+
+	if payload.Action != "published" {
+		webhook.Ignored = fmt.Sprintf("not doing anything for release action %q", payload.Action)
+	} else {
+		log.Infof("Release %q of %q was published", payload.Release.TagName, payload.Repository.FullName)
+	}
+
+	return webhook
+}
@@ -0,0 +1,223 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"github.com/boyvanduuren/octorunner/lib/pipeline"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	gitlabEventHeader    = "X-Gitlab-Event"
+	gitlabDeliveryHeader = "X-Gitlab-Event-UUID"
+	gitlabTokenHeader    = "X-Gitlab-Token"
+	// Used when no URL is configured for a repository
+	gitlabDefaultURL = "https://gitlab.com"
+)
+
+// gitlabProvider implements Provider for repositories hosted on gitlab.com or a self-hosted GitLab instance.
+type gitlabProvider struct{}
+
+type gitlabPayload struct {
+	Ref, Before, After string
+	Commits            []pushCommit `json:"commits"`
+	// The number of commits of a push, of which at most 20 are sent
+	TotalCommitsCount int `json:"total_commits_count"`
+	Project           struct {
+		Name              string
+		Path              string
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	// Only set for merge request events
+	ObjectAttributes struct {
+		IID             int `json:"iid"`
+		Action          string
+		OldRev          string `json:"oldrev"`
+		SourceBranch    string `json:"source_branch"`
+		SourceProjectID int    `json:"source_project_id"`
+		TargetProjectID int    `json:"target_project_id"`
+		LastCommit      struct {
+			ID string
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+func (p gitlabProvider) Name() string {
+	return "gitlab"
+}
+
+func (p gitlabProvider) Handles(headers http.Header) bool {
+	return headers.Get(gitlabEventHeader) != ""
+}
+
+func (p gitlabProvider) Event(headers http.Header) string {
+	return headers.Get(gitlabEventHeader)
+}
+
+func (p gitlabProvider) DeliveryID(headers http.Header) string {
+	return headers.Get(gitlabDeliveryHeader)
+}
+
+func (p gitlabProvider) ParseWebhook(event string, payloadBody []byte) (*Webhook, error) {
+	if event != "Push Hook" && event != "Tag Push Hook" && event != "Merge Request Hook" {
+		return nil, ErrUnsupportedEvent
+	}
+
+	jsonDecoder := json.NewDecoder(bytes.NewReader(payloadBody))
+	var payload gitlabPayload
+	err := jsonDecoder.Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Decoded payload to ", payload)
+
+	// Projects can be nested in groups and subgroups, everything before the project's path is its namespace
+	fullName := payload.Project.PathWithNamespace
+	owner := fullName
+	if i := strings.LastIndex(fullName, "/"); i >= 0 {
+		owner = fullName[:i]
+	}
+	webhook := &Webhook{
+		Repository: Repository{
+			FullName: fullName,
+			Owner:    owner,
+			Name:     payload.Project.Path,
+		},
+	}
+
+	if event != "Merge Request Hook" {
+		log.Info("Repository \"" + fullName + "\" was pushed to")
+		webhook.CommitID = payload.After
+		webhook.Ref = payload.Ref
+		if payload.TotalCommitsCount == len(payload.Commits) {
+			webhook.ChangedPaths = changedPaths(payload.Commits)
+		}
+		webhook.HeadCommitMessage = commitMessage(payload.Commits, payload.After)
+		if isNullCommit(payload.After) {
+			log.Infof("Ref %q of repository %q was deleted", payload.Ref, fullName)
+			webhook.CommitID = ""
+			webhook.Deleted = true
+		}
+		return webhook, nil
+	}
+
+	mergeRequest := payload.ObjectAttributes
+	webhook.CommitID = mergeRequest.LastCommit.ID
+	webhook.Ref = fmt.Sprintf("refs/merge-requests/%d/head", mergeRequest.IID)
+	webhook.PullRequest = mergeRequest.IID
+	if mergeRequest.SourceProjectID == mergeRequest.TargetProjectID {
+		webhook.HeadRef = pipeline.BranchRefPrefix + mergeRequest.SourceBranch
+	}
+	switch {
+	case mergeRequest.Action == "open" || mergeRequest.Action == "reopen":
+		log.Infof("Merge request !%d of %q was %sed", mergeRequest.IID, fullName, mergeRequest.Action)
+	case mergeRequest.Action == "update" && mergeRequest.OldRev != "":
+		log.Infof("Merge request !%d of %q received new commits", mergeRequest.IID, fullName)
+	case mergeRequest.Action == "update":
+		webhook.Ignored = "the merge request was updated without receiving new commits"
+	default:
+		webhook.Ignored = fmt.Sprintf("not doing anything for merge request action %q", mergeRequest.Action)
+	}
+
+	return webhook, nil
+}
+
+// GitLab doesn't sign deliveries, but sends the secret token that was configured for the webhook instead.
+func (p gitlabProvider) VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+	policy authentication.SignaturePolicy) string {
+	token := headers.Get(gitlabTokenHeader)
+	if token == "" {
+		log.Error("Expected token for payload, but none given")
+		return signatureMissing
+	}
+
+	if !authentication.CompareSignatures([]byte(token), repoSecret) {
+		log.Error("Tokens didn't match")
+		return signatureInvalid
+	}
+
+	return signatureValid
+}
+
+func (p gitlabProvider) ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token,
+	ref string) (string, error) {
+	var commit struct {
+		ID string
+	}
+	refName := strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+	err := apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "GET",
+		fmt.Sprintf("%s/repository/commits/%s", p.apiURL(repo), url.PathEscape(refName)), nil, &commit)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.ID, nil
+}
+
+func (p gitlabProvider) FetchSource(ctx context.Context, repo Repository, repoToken *oauth2.Token,
+	commitID string) (string, error) {
+	log.Info("Downloading archive of commit " + commitID)
+	archiveURL, err := url.Parse(fmt.Sprintf("%s/repository/archive.zip?sha=%s", p.apiURL(repo),
+		url.QueryEscape(commitID)))
+	if err != nil {
+		return "", fmt.Errorf("Error while constructing archive URL: %v", err)
+	}
+
+	return downloadArchive(oauth2.NewClient(ctx, oauth2.StaticTokenSource(repoToken)), archiveURL)
+}
+
+func (p gitlabProvider) FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	path string) ([]byte, error) {
+	return apiDownload(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)),
+		fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", p.apiURL(repo), url.PathEscape(path),
+			url.QueryEscape(commitID)))
+}
+
+func (p gitlabProvider) SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string,
+	state string, description string) error {
+	// GitLab doesn't distinguish between failed and errored pipelines
+	if state == "failure" || state == "error" {
+		state = "failed"
+	}
+
+	status := map[string]string{
+		"state": state,
+		"name":  "continuous-integration/octorunner",
+	}
+	if description != "" {
+		status["description"] = description
+	}
+	return apiRequest(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), "POST",
+		fmt.Sprintf("%s/statuses/%s", p.apiURL(repo), commitID), status, nil)
+}
+
+func (p gitlabProvider) CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error) {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		baseURL = gitlabDefaultURL
+	}
+	cloneURL, err := url.Parse(fmt.Sprintf("%s/%s.git", baseURL, repo.FullName))
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		cloneURL.User = url.UserPassword("oauth2", token.AccessToken)
+	}
+	return cloneURL, nil
+}
+
+// Returns the URL of the API endpoints of a repository. Projects are identified by their URL encoded full path.
+func (p gitlabProvider) apiURL(repo Repository) string {
+	baseURL, err := providerURL(repo.FullName)
+	if err != nil {
+		baseURL = gitlabDefaultURL
+	}
+	return fmt.Sprintf("%s/api/v4/projects/%s", baseURL, url.PathEscape(repo.FullName))
+}
@@ -0,0 +1,268 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	authentication "github.com/boyvanduuren/octorunner/lib/auth"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+/*
+Provider implementations connect octorunner to a service that hosts git repositories, like Github.
+They parse and verify the webhook deliveries that service sends, download the source of commits,
+and report the status of commits back to the service.
+*/
+type Provider interface {
+	// Name returns the name the provider is known by, e.g. "github".
+	Name() string
+	// Handles returns whether a delivery with the given headers was sent by this provider.
+	Handles(headers http.Header) bool
+	// Event returns the event type of a delivery, e.g. "push".
+	Event(headers http.Header) string
+	// DeliveryID returns the unique ID of a delivery, or an empty string if the provider doesn't send one.
+	DeliveryID(headers http.Header) string
+	// ParseWebhook decodes the payload of a delivery. ErrUnsupportedEvent is returned for events
+	// the provider doesn't handle.
+	ParseWebhook(event string, payloadBody []byte) (*Webhook, error)
+	// VerifySignature verifies a delivery using the repository's secret, and returns the result of the verification.
+	VerifySignature(headers http.Header, payloadBody []byte, repoSecret []byte,
+		policy authentication.SignaturePolicy) string
+	// ResolveCommit returns the ID of the commit a ref points to.
+	ResolveCommit(ctx context.Context, repo Repository, token *oauth2.Token, ref string) (string, error)
+	// FetchSource downloads the source of a commit to a temporary directory, and returns the directory
+	// that contains the source.
+	FetchSource(ctx context.Context, repo Repository, token *oauth2.Token, commitID string) (string, error)
+	// FetchFile returns the contents of a single file of a commit. ErrFileNotFound is returned when the commit
+	// doesn't contain the file.
+	FetchFile(ctx context.Context, repo Repository, token *oauth2.Token, commitID string, path string) ([]byte, error)
+	// SetStatus sets the status of a commit, which is either "pending", "success", "failure" or "error".
+	// The description is optional.
+	SetStatus(ctx context.Context, repo Repository, token *oauth2.Token, commitID string, state string,
+		description string) error
+	// CloneURL returns the URL a repository can be cloned from over HTTPS, with the credentials git has to use
+	// for the token set as its user info.
+	CloneURL(repo Repository, token *oauth2.Token) (*url.URL, error)
+}
+
+// Repository identifies a repository hosted by a provider.
+type Repository struct {
+	// The full name of the repository, e.g. "boyvanduuren/octorunner"
+	FullName string
+	Owner    string
+	Name     string
+}
+
+// Webhook is a decoded webhook delivery.
+type Webhook struct {
+	Repository Repository
+	// The commit to build, when empty the commit Ref points to will be built
+	CommitID    string
+	Ref         string
+	PullRequest int
+	// The branch a pull request was opened from, when it's a branch of the same repository
+	HeadRef string
+	// The paths that were added, modified or removed by the commits of a push, nil when they're unknown
+	ChangedPaths []string
+	// The message of the commit a push updated the ref to, empty when it's unknown
+	HeadCommitMessage string
+	// Whether the push deleted Ref, in which case there's no commit to build
+	Deleted bool
+	// Whether the delivery is for a published release, which isn't built when the push of its tag was built
+	Release bool
+	// The reason the delivery doesn't result in a build, empty if it does
+	Ignored string
+	// The other refs updated by the same push, which are handled like this one. Only Bitbucket sends pushes
+	// that update several refs at once.
+	Others []*Webhook
+}
+
+// Providers only send a limited number of commits with a push, when a push contains more commits we don't
+// know which paths were changed.
+const maxPushCommits = 20
+
+// A commit of a push, and the paths that were added, modified or removed by it.
+type pushCommit struct {
+	ID, Message              string
+	Added, Removed, Modified []string
+}
+
+// Returns whether a commit ID consists of only zeroes, which providers send as the new commit of a deleted ref.
+func isNullCommit(commitID string) bool {
+	return commitID != "" && strings.Trim(commitID, "0") == ""
+}
+
+// Find the message of the commit with the given ID among the commits of a push, empty if it wasn't sent.
+func commitMessage(commits []pushCommit, commitID string) string {
+	for _, commit := range commits {
+		if commit.ID == commitID {
+			return commit.Message
+		}
+	}
+	return ""
+}
+
+// Collect the paths changed by the commits of a push. Returns nil if the push doesn't contain any commits,
+// or might contain more commits than the provider sent.
+func changedPaths(commits []pushCommit) []string {
+	if len(commits) == 0 || len(commits) >= maxPushCommits {
+		return nil
+	}
+
+	paths := []string{}
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		for _, changed := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, path := range changed {
+				if !seen[path] {
+					seen[path] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// ErrUnsupportedEvent is returned by providers that receive an event they don't handle.
+var ErrUnsupportedEvent = errors.New("Event isn't supported")
+
+// ErrFileNotFound is returned by providers that are asked for a file that doesn't exist.
+var ErrFileNotFound = errors.New("File not found")
+
+// The provider used for jobs that don't have a provider stored with them.
+const defaultProvider = "github"
+
+// Providers we can receive deliveries from, in the order in which they're asked if they handle a delivery.
+var providers = []Provider{
+	giteaProvider{},
+	gitlabProvider{},
+	// Bitbucket Server sends the same event header as Bitbucket Cloud, but different events
+	bitbucketServerProvider{},
+	bitbucketProvider{},
+	githubProvider{},
+}
+
+// Find the provider that sent a delivery, returns nil if no provider handles it.
+func detectProvider(headers http.Header) Provider {
+	for _, p := range providers {
+		if p.Handles(headers) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Find a provider by its name.
+func findProvider(name string) (Provider, error) {
+	if name == "" {
+		name = defaultProvider
+	}
+	for _, p := range providers {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown provider %q", name)
+}
+
+// Look up which provider hosts a repository and where, first in the config and then in the environment.
+func providerConfig(repoFullName string) authentication.ProviderConfig {
+	config := Auth.RequestProviderConfig(repoFullName)
+
+	// We need to manually search the env, because viper doesn't seem to load these
+	// environment vars into the config.
+	if config.Provider == "" {
+		config.Provider = os.Getenv(fmt.Sprintf(envRepoProvider, strings.ToUpper(EnvPrefix), repoFullName))
+	}
+	if config.URL == "" {
+		config.URL = os.Getenv(fmt.Sprintf(envRepoURL, strings.ToUpper(EnvPrefix), repoFullName))
+	}
+	if config.UploadURL == "" {
+		config.UploadURL = os.Getenv(fmt.Sprintf(envRepoUploadURL, strings.ToUpper(EnvPrefix), repoFullName))
+	}
+
+	return config
+}
+
+// Look up the base URL of the provider hosting a repository. Returns an error when no URL is configured.
+func providerURL(repoFullName string) (string, error) {
+	providerURL := strings.TrimSuffix(providerConfig(repoFullName).URL, "/")
+	if providerURL == "" {
+		return "", fmt.Errorf("No URL configured for %q", repoFullName)
+	}
+	return providerURL, nil
+}
+
+// Send a request to the API of a provider. When body isn't nil it's sent encoded as JSON, when result
+// isn't nil the response is decoded into it.
+func apiRequest(ctx context.Context, httpClient *http.Client, method string, url string, body interface{},
+	result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	log.Debugf("Sending %s request to %q", method, url)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %q returned status %d", method, url, resp.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+
+	return nil
+}
+
+// Download a file using the API of a provider. Returns ErrFileNotFound when the API responds with 404.
+func apiDownload(ctx context.Context, httpClient *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	log.Debugf("Downloading %q", url)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrFileNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %q returned status %d", url, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+// QueueSize is the maximum number of builds that can be queued. Builds received when the queue is full
+// are rejected. A value of 0 means the queue is unbounded.
+var QueueSize int64
+
+// ErrQueueFull is returned when a build is rejected because the queue has reached QueueSize.
+var ErrQueueFull = persist.ErrQueueFull
+
+// Workers check the queue when they're notified of a new build, or after this interval has passed.
+const queuePollInterval = 10 * time.Second
+
+// Used to wake up idle workers when a build was queued.
+var queueNotify = make(chan struct{}, 1)
+
+// Store a build as a queued job, so one of the workers can pick it up. When the build doesn't have a commit ID,
+// the commit its ref points to is looked up first.
+// Returns the ID of the queued job.
+func enqueueBuild(b *build) (int64, error) {
+	if err := resolveCommit(b); err != nil {
+		return -1, err
+	}
+
+	job := b.job
+	if job == "" {
+		job = "default"
+	}
+	jobID, err := persist.DBConn.EnqueueJob(b.repo.Name, b.repo.Owner, b.commitID, job,
+		persist.JobMetadata{PullRequest: int64(b.pullRequest), Ref: b.ref, Provider: b.provider.Name(),
+			Variables: b.variables, Scheduled: b.scheduled, Pushed: b.pushed, ChangedPaths: b.changedPaths,
+			HeadRef: b.headRef}, QueueSize)
+	if err != nil {
+		return -1, err
+	}
+	log.Infof("Queued job %d for commit %q of %q", jobID, b.commitID, b.repo.FullName)
+
+	// Wake up a worker, if none is waiting one will find the job when polling
+	select {
+	case queueNotify <- struct{}{}:
+	default:
+	}
+
+	return jobID, nil
+}
+
+// Look up the commit the ref of a build points to, unless the build already has a commit ID.
+func resolveCommit(b *build) error {
+	if b.commitID != "" {
+		return nil
+	}
+
+	repoToken := repositoryToken(b.repo.FullName)
+	if repoToken == nil {
+		return fmt.Errorf("Didn't find token for %q, cannot look up the commit %q points to", b.repo.FullName, b.ref)
+	}
+
+	log.Debugf("Looking up the commit %q points to", b.ref)
+	sha, err := b.provider.ResolveCommit(context.Background(), b.repo, repoToken, b.ref)
+	if err != nil {
+		return fmt.Errorf("Error while looking up commit for %q: %v", b.ref, err)
+	}
+	b.commitID = sha
+	return nil
+}
+
+/*
+StartWorkers starts the given number of workers, which take jobs from the queue and run them one at a time.
+Jobs that were queued before octorunner was started are picked up as well, while jobs that were still running
+when octorunner stopped are marked as errored.
+*/
+func StartWorkers(workers int) {
+	interruptJobs()
+
+	log.Infof("Starting %d workers", workers)
+	for i := 0; i < workers; i++ {
+		go worker(i)
+	}
+}
+
+// Jobs that were running when octorunner stopped won't finish, so set their status and the status
+// of their commit to error.
+func interruptJobs() {
+	jobs, err := persist.DBConn.InterruptRunningJobs()
+	if err != nil {
+		log.Errorf("Error while interrupting running jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		log.Infof("Job %d was interrupted", job.ID)
+		b, err := jobBuild(job)
+		if err != nil {
+			log.Errorf("Error while reading job %d: %v", job.ID, err)
+			continue
+		}
+		repoToken := repositoryToken(b.repo.FullName)
+		if repoToken == nil {
+			continue
+		}
+		setStatus(context.Background(), b, repoToken, "error", "")
+	}
+}
+
+func worker(number int) {
+	log.Debugf("Worker %d started", number)
+	for {
+		jobID, err := persist.DBConn.DequeueJob()
+		if err != nil {
+			log.Errorf("Worker %d couldn't read from the queue: %v", number, err)
+		}
+		if jobID == -1 || err != nil {
+			select {
+			case <-queueNotify:
+			case <-time.After(queuePollInterval):
+			}
+			continue
+		}
+
+		log.Infof("Worker %d is running job %d", number, jobID)
+		runJob(jobID)
+	}
+}
+
+// Read a dequeued job from the database and run its build.
+func runJob(jobID int64) {
+	// A job that was cancelled before its build could be read is forgotten, runBuild takes care of it otherwise
+	defer untrackJob(jobID)
+
+	job, err := persist.DBConn.FindJob(jobID)
+	if err != nil {
+		log.Errorf("Error while reading job %d: %v", jobID, err)
+		failJob(context.Background(), jobID, err)
+		return
+	}
+
+	b, err := jobBuild(*job)
+	if err != nil {
+		log.Errorf("Error while reading job %d: %v", jobID, err)
+		failJob(context.Background(), jobID, err)
+		return
+	}
+
+	runBuild(b, jobID)
+}
+
+// Reconstruct the build a job was created for.
+func jobBuild(job persist.Job) (build, error) {
+	project, err := persist.DBConn.FindProjectByID(job.Project)
+	if err != nil {
+		return build{}, err
+	}
+	provider, err := findProvider(job.Provider)
+	if err != nil {
+		return build{}, err
+	}
+
+	return build{
+		provider: provider,
+		repo: Repository{
+			FullName: strings.Join([]string{project.Owner, project.Name}, "/"),
+			Owner:    project.Owner,
+			Name:     project.Name,
+		},
+		commitID:     job.CommitID,
+		ref:          job.Ref,
+		pullRequest:  int(job.PullRequest),
+		headRef:      job.HeadRef,
+		variables:    job.Variables,
+		job:          job.Job,
+		changedPaths: job.ChangedPaths,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"golang.org/x/net/context"
+)
+
+// ErrJobActive is returned when a job is retried while it's still queued or running.
+var ErrJobActive = errors.New("Job is still queued or running")
+
+/*
+RetryJob queues the commit and job name of an existing job again, which creates the next iteration of the job.
+The new job is built for the same ref, pull request and variables. Jobs that are still queued or running can't
+be retried. Retries never cancel other jobs, not even with AutoCancel enabled.
+Returns the ID of the new job.
+*/
+func RetryJob(job persist.Job) (int64, error) {
+	if job.Active() {
+		return -1, ErrJobActive
+	}
+
+	b, err := jobBuild(job)
+	if err != nil {
+		return -1, err
+	}
+
+	log.Infof("Job %d of %q was retried", job.ID, b.repo.FullName)
+	jobID, err := enqueueBuild(&b)
+	if err != nil {
+		return -1, err
+	}
+
+	// The commit keeps the status of the previous iteration until a worker picks up the new one
+	repoToken := repositoryToken(b.repo.FullName)
+	if repoToken != nil {
+		setStatus(context.Background(), b, repoToken, "pending", fmt.Sprintf("Retried as job %d", jobID))
+	}
+
+	return jobID, nil
+}
@@ -0,0 +1,128 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/common"
+	"strings"
+	"time"
+)
+
+/*
+Schedule describes a pipeline that runs periodically for the current head of a ref, as configured in the
+schedules section of a repository. Cron is a cron expression, Ref is taken to be a branch when it doesn't start
+with "refs/", and every variable is formatted as "NAME=value".
+*/
+type Schedule struct {
+	Cron      string
+	Ref       string
+	Variables []string
+}
+
+// A schedule that was validated, for a single repository.
+type repositorySchedule struct {
+	repo      Repository
+	cron      *common.CronSchedule
+	ref       string
+	variables map[string]string
+}
+
+/*
+StartScheduler starts a scheduler for every valid schedule, which queues a build of the current head of the
+schedule's ref whenever the cron expression matches. Schedules are given per full name of their repository.
+Invalid schedules are logged and ignored.
+*/
+func StartScheduler(schedules map[string][]Schedule) {
+	count := 0
+	for repoFullName, repoSchedules := range schedules {
+		for _, schedule := range repoSchedules {
+			s, err := parseSchedule(repoFullName, schedule)
+			if err != nil {
+				log.Errorf("Ignoring schedule %q of %q: %v", schedule.Cron, repoFullName, err)
+				continue
+			}
+			go s.run()
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Infof("Started %d schedules", count)
+	}
+}
+
+// Validate a schedule of a repository.
+func parseSchedule(repoFullName string, schedule Schedule) (repositorySchedule, error) {
+	i := strings.LastIndex(repoFullName, "/")
+	if i < 0 {
+		return repositorySchedule{}, fmt.Errorf("%q isn't the full name of a repository", repoFullName)
+	}
+	if schedule.Ref == "" {
+		return repositorySchedule{}, errors.New("A ref is required")
+	}
+	cron, err := common.ParseCron(schedule.Cron)
+	if err != nil {
+		return repositorySchedule{}, err
+	}
+
+	variables := make(map[string]string)
+	for _, variable := range schedule.Variables {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 {
+			return repositorySchedule{}, fmt.Errorf("Variable %q isn't formatted as NAME=value", variable)
+		}
+		if !variableName.MatchString(parts[0]) {
+			return repositorySchedule{}, InvalidVariableError{Name: parts[0]}
+		}
+		variables[parts[0]] = parts[1]
+	}
+
+	return repositorySchedule{
+		repo: Repository{
+			FullName: repoFullName,
+			Owner:    repoFullName[:i],
+			Name:     repoFullName[i+1:],
+		},
+		cron:      cron,
+		ref:       qualifyRef(schedule.Ref),
+		variables: variables,
+	}, nil
+}
+
+// Wait until the schedule matches and queue a build, forever.
+func (s repositorySchedule) run() {
+	for {
+		next := s.cron.Next(time.Now())
+		if next.IsZero() {
+			log.Errorf("Schedule of %q for %q never matches, stopping it", s.repo.FullName, s.ref)
+			return
+		}
+		log.Debugf("Next scheduled build of %q for %q is at %v", s.repo.FullName, s.ref, next)
+		time.Sleep(next.Sub(time.Now()))
+
+		s.enqueue()
+	}
+}
+
+// Queue a build of the commit the schedule's ref currently points to.
+func (s repositorySchedule) enqueue() {
+	provider, err := findProvider(providerConfig(s.repo.FullName).Provider)
+	if err != nil {
+		log.Errorf("Error while queueing scheduled build of %q: %v", s.repo.FullName, err)
+		return
+	}
+
+	log.Infof("Scheduled build of %q for %q is due", s.repo.FullName, s.ref)
+	// Without a commit ID, the commit the ref points to is looked up when the build is queued
+	_, err = enqueueBuild(&build{
+		provider:  provider,
+		repo:      s.repo,
+		ref:       s.ref,
+		variables: s.variables,
+		scheduled: true,
+	})
+	if err != nil {
+		log.Errorf("Error while queueing scheduled build of %q: %v", s.repo.FullName, err)
+	}
+}
@@ -0,0 +1,75 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"regexp"
+	"strings"
+)
+
+// ErrMissingRef is returned when a build is triggered without a ref or commit ID.
+var ErrMissingRef = errors.New("Either a ref or a commit ID is required")
+
+// InvalidVariableError is returned when a build is triggered with a variable that can't be an environment variable.
+type InvalidVariableError struct {
+	Name string
+}
+
+func (e InvalidVariableError) Error() string {
+	return fmt.Sprintf("Invalid variable %q, variable names may only contain letters, digits and underscores, "+
+		"and can't start with a digit", e.Name)
+}
+
+var variableName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+/*
+TriggerBuild queues a build of a project, as if the commit was pushed. The commit is either given by its ID, or
+looked up from the ref. Refs that don't start with "refs/" are taken to be branches. The variables are passed
+to the job as environment variables.
+Returns the IDs of the queued jobs.
+*/
+func TriggerBuild(project persist.Project, ref string, commitID string, variables map[string]string) ([]int64, error) {
+	if ref == "" && commitID == "" {
+		return nil, ErrMissingRef
+	}
+	for name := range variables {
+		if !variableName.MatchString(name) {
+			return nil, InvalidVariableError{Name: name}
+		}
+	}
+	ref = qualifyRef(ref)
+
+	repo := Repository{
+		FullName: strings.Join([]string{project.Owner, project.Name}, "/"),
+		Owner:    project.Owner,
+		Name:     project.Name,
+	}
+	provider, err := findProvider(providerConfig(repo.FullName).Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Build of %q was triggered, ref %q, commit %q", repo.FullName, ref, commitID)
+	jobID, err := enqueueBuild(&build{
+		provider:  provider,
+		repo:      repo,
+		commitID:  commitID,
+		ref:       ref,
+		variables: variables,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []int64{jobID}, nil
+}
+
+// Refs that don't start with "refs/" are taken to be branches.
+func qualifyRef(ref string) string {
+	if ref != "" && !strings.HasPrefix(ref, "refs/") {
+		return "refs/heads/" + ref
+	}
+	return ref
+}
@@ -0,0 +1,146 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Delivery is a webhook delivery as it was received by octorunner, together with what was done with it.
+type Delivery struct {
+	ID int64
+	// The ID Github assigned to this delivery, taken from the X-GitHub-Delivery header
+	DeliveryID string
+	Event      string
+	Headers    http.Header
+	Body       string
+	// The result of verifying the delivery's signature, e.g. "valid" or "invalid"
+	Signature string
+	// A description of what was done with the delivery
+	Outcome string
+	// The ID of the job that was queued for this delivery, 0 if no job was queued
+	Job      int64
+	Received time.Time
+}
+
+// Headers that contain secrets, which aren't stored. GitLab sends the secret of a repository along as a token.
+var secretHeaders = []string{"X-Gitlab-Token", "Authorization"}
+
+// RedactHeaders returns a copy of the headers of a delivery, without the headers that contain secrets.
+func RedactHeaders(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		redacted[name] = values
+	}
+	for _, name := range secretHeaders {
+		redacted.Del(name)
+	}
+	return redacted
+}
+
+/*
+CreateDelivery stores a received webhook delivery, except for the headers that contain secrets.
+Returns the ID of the stored delivery.
+*/
+func (db *DB) CreateDelivery(delivery Delivery) (int64, error) {
+	headers, err := json.Marshal(RedactHeaders(delivery.Headers))
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := tx.Exec("INSERT INTO Deliveries VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)",
+		delivery.DeliveryID, delivery.Event, string(headers), delivery.Body, delivery.Signature,
+		delivery.Outcome, delivery.Job, delivery.Received)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+	log.Debugf("Stored delivery %q with ID %d", delivery.DeliveryID, id)
+
+	return id, nil
+}
+
+// FindDeliveries returns all stored deliveries without their headers and body, the most recent delivery first.
+// Used for the webapi get "api/deliveries".
+func (db *DB) FindDeliveries() ([]Delivery, error) {
+	rows, err := db.Connection.Query("SELECT id(), deliveryID, event, signature, outcome, job, received " +
+		"FROM Deliveries ORDER BY id() DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		err = rows.Scan(&d.ID, &d.DeliveryID, &d.Event, &d.Signature, &d.Outcome, &d.Job, &d.Received)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// FindDelivery returns a single delivery, including its headers and body.
+// Used for the webapi get "api/deliveries/:deliveryID".
+func (db *DB) FindDelivery(id int64) (*Delivery, error) {
+	var headers string
+	d := Delivery{ID: id}
+
+	row := db.Connection.QueryRow("SELECT deliveryID, event, headers, body, signature, outcome, job, received "+
+		"FROM Deliveries WHERE id() = ?1", id)
+	err := row.Scan(&d.DeliveryID, &d.Event, &headers, &d.Body, &d.Signature, &d.Outcome, &d.Job, &d.Received)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't find delivery with ID %d", id)
+	}
+
+	err = json.Unmarshal([]byte(headers), &d.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading headers of delivery %d: %v", id, err)
+	}
+
+	return &d, nil
+}
+
+/*
+FindAcceptedDelivery looks for an earlier delivery with the given Github delivery ID that resulted in a queued job.
+Returns nil if no such delivery exists.
+*/
+func (db *DB) FindAcceptedDelivery(deliveryID string) (*Delivery, error) {
+	rows, err := db.Connection.Query("SELECT id() FROM Deliveries WHERE deliveryID = ?1 AND job > 0 "+
+		"ORDER BY id() ASC LIMIT 1", deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+	var id int64
+	err = rows.Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	return db.FindDelivery(id)
+}
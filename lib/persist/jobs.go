@@ -2,18 +2,52 @@ package persist
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 )
 
 type Job struct {
-	ID        int64
-	Iteration int64
-	Project   int64
-	CommitID  string
-	Job       string
-	Status    string
-	Extra     string
-	Data      []*Output
+	ID          int64
+	Iteration   int64
+	Project     int64
+	CommitID    string
+	Job         string
+	Status      string
+	Extra       string
+	PullRequest int64
+	Ref         string
+	Provider    string
+	Variables   map[string]string
+	Scheduled   bool
+	Pushed      bool
+	// The paths changed by the push the job was created for, nil when they're unknown
+	ChangedPaths []string
+	HeadRef      string
+	// The position of this job in the queue, starting at 1. 0 if the job isn't queued.
+	QueuePosition int64
+	Data          []*Output
+}
+
+// JobMetadata contains information about the event that caused a job to be created.
+type JobMetadata struct {
+	// The number of the pull request this job was created for, 0 if it wasn't created for a pull request.
+	PullRequest int64
+	// The git ref this job was created for, e.g. "refs/heads/master" or "refs/tags/v1.0.0".
+	Ref string
+	// The name of the provider hosting the repository, e.g. "github".
+	Provider string
+	// Environment variables that are passed to the job, besides the ones octorunner sets itself.
+	Variables map[string]string
+	// Whether the job was created by a schedule, instead of by an event or a request.
+	Scheduled bool
+	// Whether the job was created for a push or pull request delivered by a webhook. Only these jobs supersede
+	// each other, jobs that were triggered, retried or scheduled are left alone.
+	Pushed bool
+	// The paths added, modified or removed by the push the job was created for, nil when they're unknown.
+	ChangedPaths []string
+	// The branch a pull request was opened from, e.g. "refs/heads/feature", when it's a branch of the same
+	// repository. Empty if the job wasn't created for a pull request, or if it was opened from a fork.
+	HeadRef string
 }
 
 type JobStatus int
@@ -22,6 +56,9 @@ const (
 	STATUS_DONE JobStatus = iota
 	STATUS_RUNNING
 	STATUS_ERROR
+	STATUS_QUEUED
+	STATUS_SKIPPED
+	STATUS_CANCELLED
 )
 
 func statusToString(status JobStatus) string {
@@ -33,10 +70,21 @@ func statusToString(status JobStatus) string {
 		statusText = "running"
 	case STATUS_ERROR:
 		statusText = "error"
+	case STATUS_QUEUED:
+		statusText = "queued"
+	case STATUS_SKIPPED:
+		statusText = "skipped"
+	case STATUS_CANCELLED:
+		statusText = "cancelled"
 	}
 	return statusText
 }
 
+// Active returns whether a job is still queued or running.
+func (job Job) Active() bool {
+	return job.Status == statusToString(STATUS_QUEUED) || job.Status == statusToString(STATUS_RUNNING)
+}
+
 func (db *DB) findJobID(projectID int64, commitID string, job string, iteration int64) int64 {
 	var id *int64
 	_ = db.Connection.QueryRow("SELECT id() FROM Jobs WHERE project = ?1 "+
@@ -67,42 +115,91 @@ func (db *DB) findJobIDs(projectID int64, commitID string, job string) ([]int64,
 	return IDs, nil
 }
 
-func (db *DB) createJob(projectID int64, commitID string, job string) (int64, error) {
+// Insert the next iteration of a job as part of a transaction, so it can be created together with related rows.
+func insertJob(tx *sql.Tx, projectID int64, commitID string, job string, status JobStatus, extra string,
+	metadata JobMetadata) (int64, error) {
 	// Make sure we refer to an existing project
-	rows, err := db.Connection.Query("SELECT id() FROM Projects WHERE id() = ?1 ", projectID)
-	if err != nil || !rows.Next() {
+	var projects int64
+	err := tx.QueryRow("SELECT count(*) FROM Projects WHERE id() = ?1", projectID).Scan(&projects)
+	if err != nil {
+		return -1, err
+	}
+	if projects == 0 {
 		return -1, fmt.Errorf("Cannot create job for project with ID %d as it doesn't exist", projectID)
 	}
 
 	// Retrieve the latest iteration ID of this job, which might not exist
 	var latestJobIteration int64
-	row := db.Connection.QueryRow("SELECT iteration FROM Jobs WHERE project = ?1 AND " +
-		"commitID = ?2", projectID, commitID)
-	err = row.Scan(&latestJobIteration)
-	if err == sql.ErrNoRows {
-		latestJobIteration = 0
-	} else if err != nil {
+	var maxIteration *int64
+	row := tx.QueryRow("SELECT max(iteration) FROM Jobs WHERE project = ?1 AND "+
+		"commitID = ?2 AND job = ?3", projectID, commitID, job)
+	err = row.Scan(&maxIteration)
+	if err != nil && err != sql.ErrNoRows {
 		return -1, err
 	}
+	if maxIteration != nil {
+		latestJobIteration = *maxIteration
+	}
 
-	tx, err := db.Connection.Begin()
+	// Variables are stored as a JSON object, and changed paths as a JSON array
+	var variables, changedPaths *string
+	if len(metadata.Variables) > 0 {
+		encoded, err := json.Marshal(metadata.Variables)
+		if err != nil {
+			return -1, err
+		}
+		encodedString := string(encoded)
+		variables = &encodedString
+	}
+	if metadata.ChangedPaths != nil {
+		encoded, err := json.Marshal(metadata.ChangedPaths)
+		if err != nil {
+			return -1, err
+		}
+		encodedString := string(encoded)
+		changedPaths = &encodedString
+	}
+
+	res, err := tx.Exec("INSERT INTO Jobs (project, commitID, job, status, extra, iteration, pullRequest, ref, "+
+		"provider, variables, scheduled, pushed, changedPaths, headRef) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, "+
+		"?10, ?11, ?12, ?13, ?14)", projectID, commitID, job, statusToString(status), extra, latestJobIteration+1,
+		metadata.PullRequest, metadata.Ref, metadata.Provider, variables, metadata.Scheduled, metadata.Pushed,
+		changedPaths, metadata.HeadRef)
 	if err != nil {
 		return -1, err
 	}
 
-	res, err := tx.Exec("INSERT INTO Jobs (project, commitID, job, status, iteration)"+
-		" VALUES (?1, ?2, ?3, ?4, ?5)", projectID, commitID, job, "running", latestJobIteration+1)
-	tx.Commit()
+	return res.LastInsertId()
+}
+
+/*
+CreateSkippedJob creates a new job with status "skipped", which records why a job wasn't ran. The project the job
+belongs to is created if it doesn't exist yet.
+Returns the ID of the created job.
+*/
+func (db *DB) CreateSkippedJob(projectName string, projectOwner string, commitID string, job string,
+	metadata JobMetadata, reason string) (int64, error) {
+	projectID, err := db.findOrCreateProject(projectName, projectOwner)
 	if err != nil {
 		return -1, err
 	}
 
-	id, err := res.LastInsertId()
+	tx, err := db.Connection.Begin()
 	if err != nil {
 		return -1, err
 	}
 
-	return id, nil
+	jobID, err := insertJob(tx, projectID, commitID, job, STATUS_SKIPPED, reason, metadata)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+
+	return jobID, nil
 }
 
 // UpdateJobStatus sets the status of a job and allows for some extra information to be passed as string.
@@ -114,31 +211,115 @@ func (db *DB) UpdateJobStatus(jobID int64, status JobStatus, extra string) error
 
 	_, err = tx.Exec("UPDATE Jobs SET status = ?1, extra = ?2 WHERE id() = ?3",
 		statusToString(status), extra, jobID)
-	tx.Commit()
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // Find all jobs that belong to a specific project. This doesn't query the data belonging to every job.
 // Used for the webapi get "api/projects/:ProjectID/jobs".
 func (db *DB) FindJobsForProject(projectID int64) ([]Job, error) {
-	var jobs []Job
+	rows, err := db.Connection.Query("SELECT id(), iteration, commitID, job, status, pullRequest, ref, provider, "+
+		"scheduled, pushed, extra FROM Jobs WHERE project = ?1", projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanJobs(rows, projectID)
+}
+
+// FindJobsForPullRequest finds all jobs that were created for a specific pull request of a project.
+// Used for the webapi get "api/projects/:ProjectID/jobs?pullRequest=:PullRequest".
+func (db *DB) FindJobsForPullRequest(projectID int64, pullRequest int64) ([]Job, error) {
+	rows, err := db.Connection.Query("SELECT id(), iteration, commitID, job, status, pullRequest, ref, provider, "+
+		"scheduled, pushed, extra FROM Jobs WHERE project = ?1 AND pullRequest = ?2 ORDER BY id() ASC",
+		projectID, pullRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanJobs(rows, projectID)
+}
+
+/*
+FindActiveJobsForRef finds the queued and running jobs that were created for a git ref of a project, ordered by
+their ID. Returns an empty slice if the project doesn't exist.
+*/
+func (db *DB) FindActiveJobsForRef(projectName string, projectOwner string, ref string) ([]Job, error) {
+	projectID := db.findProjectID(projectName, projectOwner)
+	if projectID == -1 {
+		return []Job{}, nil
+	}
+
+	rows, err := db.Connection.Query("SELECT id(), iteration, commitID, job, status, pullRequest, ref, provider, "+
+		"scheduled, pushed, extra FROM Jobs WHERE project = ?1 AND ref = ?2 AND (status = ?3 OR status = ?4) "+
+		"ORDER BY id() ASC", projectID, ref, statusToString(STATUS_QUEUED), statusToString(STATUS_RUNNING))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanJobs(rows, projectID)
+}
+
+/*
+FindActiveJobsForHeadRef finds the queued and running jobs of pull requests that were opened from a branch of a
+project, ordered by their ID. Returns an empty slice if the project doesn't exist.
+*/
+func (db *DB) FindActiveJobsForHeadRef(projectName string, projectOwner string, headRef string) ([]Job, error) {
+	projectID := db.findProjectID(projectName, projectOwner)
+	if projectID == -1 {
+		return []Job{}, nil
+	}
 
-	rows, err := db.Connection.Query("SELECT id(), iteration, commitID, job, status, extra "+
-		"FROM Jobs WHERE project = ?1", projectID)
+	rows, err := db.Connection.Query("SELECT id(), iteration, commitID, job, status, pullRequest, ref, provider, "+
+		"scheduled, pushed, extra FROM Jobs WHERE project = ?1 AND headRef = ?2 AND (status = ?3 OR status = ?4) "+
+		"ORDER BY id() ASC", projectID, headRef, statusToString(STATUS_QUEUED), statusToString(STATUS_RUNNING))
 	if err != nil {
 		return nil, err
 	}
 
+	return scanJobs(rows, projectID)
+}
+
+/*
+HasJobForCommit returns whether a job that wasn't cancelled was created for a commit of a git ref of a project.
+*/
+func (db *DB) HasJobForCommit(projectName string, projectOwner string, ref string, commitID string) (bool, error) {
+	projectID := db.findProjectID(projectName, projectOwner)
+	if projectID == -1 {
+		return false, nil
+	}
+
+	var count int64
+	err := db.Connection.QueryRow("SELECT count(*) FROM Jobs WHERE project = ?1 AND ref = ?2 AND commitID = ?3 "+
+		"AND status != ?4", projectID, ref, commitID, statusToString(STATUS_CANCELLED)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func scanJobs(rows *sql.Rows, projectID int64) ([]Job, error) {
+	defer rows.Close()
+	var jobs []Job
+
 	for rows.Next() {
 		var id, iteration int64
-		var commitID, job, status, extra string
-
-		rows.Scan(&id, &iteration, &commitID, &job, &status, &extra)
-		jobs = append(jobs, Job{
+		var commitID, job, status string
+		var pullRequest *int64
+		var ref, provider, extra *string
+		var scheduled, pushed *bool
+
+		err := rows.Scan(&id, &iteration, &commitID, &job, &status, &pullRequest, &ref, &provider, &scheduled, &pushed,
+			&extra)
+		if err != nil {
+			return nil, err
+		}
+		j := Job{
 			ID:        id,
 			Iteration: iteration,
 			Project:   projectID,
@@ -146,41 +327,112 @@ func (db *DB) FindJobsForProject(projectID int64) ([]Job, error) {
 			Job:       job,
 			Data:      nil,
 			Status:    status,
-			Extra:     extra,
-		})
+		}
+		if pullRequest != nil {
+			j.PullRequest = *pullRequest
+		}
+		if ref != nil {
+			j.Ref = *ref
+		}
+		if provider != nil {
+			j.Provider = *provider
+		}
+		if scheduled != nil {
+			j.Scheduled = *scheduled
+		}
+		if pushed != nil {
+			j.Pushed = *pushed
+		}
+		if extra != nil {
+			j.Extra = *extra
+		}
+		jobs = append(jobs, j)
 	}
 
-	return jobs, nil
+	return jobs, rows.Err()
+}
+
+// FindJob finds a job and returns it, without the Output data related to it.
+func (db *DB) FindJob(jobID int64) (*Job, error) {
+	var iteration, project int64
+	var commitID, job, status string
+	var pullRequest *int64
+	var ref, provider, variables, changedPaths, headRef, extra *string
+	var scheduled, pushed *bool
+
+	row := db.Connection.QueryRow("SELECT iteration, project, commitID, job, status, pullRequest, ref, provider, "+
+		"variables, scheduled, pushed, changedPaths, headRef, extra FROM Jobs WHERE id() = ?1", jobID)
+	err := row.Scan(&iteration, &project, &commitID, &job, &status, &pullRequest, &ref, &provider, &variables,
+		&scheduled, &pushed, &changedPaths, &headRef, &extra)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Couldn't find job with ID %d", jobID)
+	} else if err != nil {
+		return nil, fmt.Errorf("Couldn't read job with ID %d: %v", jobID, err)
+	}
+
+	foundJob := &Job{
+		ID:        jobID,
+		Iteration: iteration,
+		Project:   project,
+		CommitID:  commitID,
+		Job:       job,
+		Status:    status,
+	}
+	if pullRequest != nil {
+		foundJob.PullRequest = *pullRequest
+	}
+	if ref != nil {
+		foundJob.Ref = *ref
+	}
+	if provider != nil {
+		foundJob.Provider = *provider
+	}
+	if scheduled != nil {
+		foundJob.Scheduled = *scheduled
+	}
+	if pushed != nil {
+		foundJob.Pushed = *pushed
+	}
+	if headRef != nil {
+		foundJob.HeadRef = *headRef
+	}
+	if extra != nil {
+		foundJob.Extra = *extra
+	}
+	if variables != nil {
+		err := json.Unmarshal([]byte(*variables), &foundJob.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read variables of job with ID %d: %v", jobID, err)
+		}
+	}
+	if changedPaths != nil {
+		err := json.Unmarshal([]byte(*changedPaths), &foundJob.ChangedPaths)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read changed paths of job with ID %d: %v", jobID, err)
+		}
+	}
+	if status == statusToString(STATUS_QUEUED) {
+		foundJob.QueuePosition = db.queuePosition(jobID)
+	}
+
+	return foundJob, nil
 }
 
 // FindJobWithData finds a job and returns it, with all the
 // Output data related to it already fetched.
 func (db *DB) FindJobWithData(jobID int64) (*Job, error) {
-	var iteration int64
-	var commitID, job, status, extra string
-
-	row := db.Connection.QueryRow("SELECT iteration, commitID, job, status, extra FROM Jobs WHERE id() = ?1", jobID)
-	row.Scan(&iteration, &commitID, &job, &status, &extra)
-
-	if commitID == "" {
-		return nil, fmt.Errorf("Couldn't find project with ID %q", jobID)
+	foundJob, err := db.FindJob(jobID)
+	if err != nil {
+		return nil, err
 	}
 
 	data, err := db.findAllOutputForJob(jobID)
 	if err != nil {
 		return nil, err
 	}
+	foundJob.Data = data
 
-	return &Job{
-		ID:        jobID,
-		Iteration: iteration,
-		Project:   jobID,
-		CommitID:  commitID,
-		Job:       job,
-		Status:    status,
-		Extra:     extra,
-		Data:      data,
-	}, nil
+	return foundJob, nil
 }
 
 // GetLatestJobID returns the latest jobID. The return value will be < 1 if no job was found.
@@ -42,42 +42,28 @@ func (db *DB) createOutput(jobID int64, data, date string) (int64, error) {
 
 /*
 CreateOutputWriter returns a function that can be used to write to the "Output" table. That table is used
-to write test output to. Test output belongs to a certain job, which in turn belongs to a project. Before
-returning the writer we make sure these tuples exist or are created.
-Returns the writer function, the job ID and an error in case anything goes wrong.
+to write test output to. Test output belongs to a certain job, which has to exist before a writer can
+be returned for it.
+Returns the writer function and an error in case anything goes wrong.
 */
-func (db *DB) CreateOutputWriter(projectName string, projectOwner string, commitID string,
-	job string) (func(string, string) (int64, error), int64, error) {
-	var err error
-	// Get the ID of this project
-	log.Debugf("Querying for project ID of project with name %q and owner %q", projectName, projectOwner)
-	projectID := db.findProjectID(projectName, projectOwner)
-
-	if projectID == -1 {
-		// Project isn't known in the database, so create it
-		log.Debugf("Project not found, creating")
-		projectID, err = db.createProject(projectName, projectOwner)
-		if err != nil {
-			return nil, -1, err
-		}
-	}
-	log.Debugf("Project has ID %d", projectID)
-
-	// Always create a new job iteration
-	jobID, err := db.createJob(projectID, commitID, job)
+func (db *DB) CreateOutputWriter(jobID int64) (func(string, string) (int64, error), error) {
+	rows, err := db.Connection.Query("SELECT id() FROM Jobs WHERE id() = ?1", jobID)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, fmt.Errorf("Cannot create writer for job with ID %d as it doesn't exist", jobID)
 	}
-	log.Debugf("Job has ID %d", jobID)
 
-	log.Debugf("Returning a writer for project %d, job %d", projectID, jobID)
+	log.Debugf("Returning a writer for job %d", jobID)
 	return func(line, date string) (int64, error) {
 		outputID, err := db.createOutput(jobID, line, date)
 		if err != nil {
 			return -1, err
 		}
 		return outputID, nil
-	}, jobID, nil
+	}, nil
 }
 
 func (db *DB) findAllOutputForJob(jobID int64) ([]*Output, error) {
@@ -43,14 +43,22 @@ func (db *DB) initializeDatabase() error {
 	creationQueries := []string{
 		"CREATE TABLE IF NOT EXISTS Projects (name string, owner string)",
 		"CREATE TABLE IF NOT EXISTS Jobs (project int, commitID string, job string, status string," +
-			"extra string, iteration int)",
+			"extra string, iteration int, pullRequest int, ref string, provider string, variables string," +
+			"scheduled bool, pushed bool, changedPaths string, headRef string)",
 		"CREATE TABLE IF NOT EXISTS Output (job int, data string, timestamp time)",
+		"CREATE TABLE IF NOT EXISTS Queue (job int, queued time)",
+		"CREATE TABLE IF NOT EXISTS Deliveries (deliveryID string, event string, headers string, body string," +
+			"signature string, outcome string, job int, received time)",
 		"CREATE UNIQUE INDEX IF NOT EXISTS ProjectsID ON Projects (id())",
 		"CREATE UNIQUE INDEX IF NOT EXISTS ProjectRepository ON Projects (name, owner)",
 		"CREATE UNIQUE INDEX IF NOT EXISTS JobsID ON Jobs (id())",
 		"CREATE UNIQUE INDEX IF NOT EXISTS JobsProjectCommit ON Jobs (project, commitID, job, iteration)",
 		"CREATE UNIQUE INDEX IF NOT EXISTS OutputID ON Output (id())",
 		"CREATE INDEX IF NOT EXISTS OutputJob ON Output (job)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS QueueID ON Queue (id())",
+		"CREATE UNIQUE INDEX IF NOT EXISTS QueueJob ON Queue (job)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS DeliveriesID ON Deliveries (id())",
+		"CREATE INDEX IF NOT EXISTS DeliveriesDeliveryID ON Deliveries (deliveryID)",
 	}
 
 	for _, q := range creationQueries {
@@ -61,9 +69,51 @@ func (db *DB) initializeDatabase() error {
 		}
 	}
 
+	// Databases created by older versions of octorunner lack columns that were added later on
+	addedColumns := []struct {
+		table, column, columnType string
+	}{
+		{"Jobs", "pullRequest", "int"},
+		{"Jobs", "ref", "string"},
+		{"Jobs", "provider", "string"},
+		{"Jobs", "variables", "string"},
+		{"Jobs", "scheduled", "bool"},
+		{"Jobs", "pushed", "bool"},
+		{"Jobs", "changedPaths", "string"},
+		{"Jobs", "headRef", "string"},
+	}
+
+	for _, c := range addedColumns {
+		exists, err := columnExists(tx, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		q := fmt.Sprintf("ALTER TABLE %s ADD %s %s", c.table, c.column, c.columnType)
+		log.Debugf("Executing query %q", q)
+		_, err = tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Error on query %q: %q", q, err)
+		}
+	}
+
 	err = tx.Commit()
 	log.Debug("Transaction committed")
 	log.Info("Initialized database")
 
 	return err
 }
+
+// columnExists uses the __Column system table to check whether a table contains a certain column.
+func columnExists(tx *sql.Tx, table string, column string) (bool, error) {
+	var count int64
+	err := tx.QueryRow("SELECT count(*) FROM __Column WHERE TableName = ?1 AND Name = ?2",
+		table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -1,7 +1,9 @@
 package persist
 
 import (
+	"net/http"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -75,7 +77,7 @@ func TestCreateJob(t *testing.T) {
 	// Create a job belonging to the project we just created
 	job01CommitID := "deadbeef"
 	job01Name := "jobname"
-	jobID, err := conn.createJob(projectID, job01CommitID, job01Name)
+	jobID, err := conn.EnqueueJob(projectName01, projectOwner01, job01CommitID, job01Name, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -92,7 +94,7 @@ func TestCreateJob(t *testing.T) {
 	// Create a second job
 	job02CommitID := "cafebabe"
 	job02Name := "default"
-	jobID, err = conn.createJob(projectID, job02CommitID, job02Name)
+	jobID, err = conn.EnqueueJob(projectName01, projectOwner01, job02CommitID, job02Name, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -108,7 +110,7 @@ func TestCreateJob(t *testing.T) {
 
 	// Create a duplicate job (that is, the projectID, commitID and job's name already exist)
 	// This shouldn't error, because a new iteration ID is generated for this job.
-	jobID, err = conn.createJob(projectID, job01CommitID, job01Name)
+	jobID, err = conn.EnqueueJob(projectName01, projectOwner01, job01CommitID, job01Name, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatalf("Unexpected error while creating duplicate job: %q", err)
 	}
@@ -119,8 +121,23 @@ func TestCreateJob(t *testing.T) {
 		t.Fatalf("Expected id %d, got %d", jobID, foundJobID)
 	}
 
+	// A third iteration should follow the latest iteration
+	jobID, err = conn.EnqueueJob(projectName01, projectOwner01, job01CommitID, job01Name, JobMetadata{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while creating duplicate job: %q", err)
+	}
+	foundJobID = conn.findJobID(projectID, job01CommitID, "jobname", 3)
+	if foundJobID != jobID {
+		t.Fatalf("Expected id %d, got %d", jobID, foundJobID)
+	}
+
 	// Create a job for a projectID that doesn't exist, this should error
-	_, err = conn.createJob(projectID+1, "cafebabe", "jobname")
+	tx, err := conn.Connection.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = insertJob(tx, projectID+1, "cafebabe", "jobname", STATUS_QUEUED, "", JobMetadata{})
+	tx.Rollback()
 	if err == nil {
 		t.Fatal("Expected an error while creating a job for a projectID that doesn't exist")
 	}
@@ -140,7 +157,7 @@ func TestUpdateJob(t *testing.T) {
 	// Create a job belonging to the project we just created
 	jobCommitID := "deadbeef"
 	jobName := "jobname"
-	jobID, err := conn.createJob(projectID, jobCommitID, jobName)
+	jobID, err := conn.EnqueueJob(projectName, projectOwner, jobCommitID, jobName, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -182,9 +199,13 @@ func TestFindJob(t *testing.T) {
 	if id != -1 {
 		t.Fatal("Expected ID -1 when searching for non-existent job")
 	}
+	_, err = conn.FindJob(conn.GetLatestJobID() + 1)
+	if err == nil {
+		t.Fatal("Expected an error when finding a non-existent job, but didn't get one")
+	}
 
 	// Create the job
-	createdID_01, err := conn.createJob(projectID, commitID, jobName)
+	createdID_01, err := conn.EnqueueJob(projectName, projectOwner, commitID, jobName, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -196,7 +217,7 @@ func TestFindJob(t *testing.T) {
 	}
 
 	// Create a new iteration of the job
-	createdID_02, err := conn.createJob(projectID, commitID, jobName)
+	createdID_02, err := conn.EnqueueJob(projectName, projectOwner, commitID, jobName, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -222,13 +243,117 @@ func TestFindJob(t *testing.T) {
 
 }
 
+func TestJobVariables(t *testing.T) {
+	projectName := "TestJobVariables"
+	projectOwner := "bcd"
+
+	projectID, err := conn.createProject(projectName, projectOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := map[string]string{"DEPLOY": "true", "TARGET": "staging"}
+	jobID, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default",
+		JobMetadata{Variables: variables}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := conn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(job.Variables, variables) {
+		t.Fatalf("Expected variables %v, got %v", variables, job.Variables)
+	}
+
+	// Jobs without variables don't get an empty map
+	jobID, err = conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", JobMetadata{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = conn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Variables != nil {
+		t.Fatalf("Expected no variables, got %v", job.Variables)
+	}
+}
+
+func TestJobChangedPaths(t *testing.T) {
+	projectName := "TestJobChangedPaths"
+	projectOwner := "bcd"
+
+	cases := []struct {
+		changedPaths []string
+	}{
+		{[]string{"main.go", "docs/README.md"}},
+		// A push that didn't change any paths differs from a push of which the changed paths are unknown
+		{[]string{}},
+		{nil},
+	}
+
+	for _, c := range cases {
+		jobID, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default",
+			JobMetadata{ChangedPaths: c.changedPaths}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, err := conn.FindJob(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(job.ChangedPaths, c.changedPaths) {
+			t.Errorf("Expected changed paths %#v, got %#v", c.changedPaths, job.ChangedPaths)
+		}
+	}
+}
+
+func TestScheduledJob(t *testing.T) {
+	projectName := "TestScheduledJob"
+	projectOwner := "bcd"
+
+	scheduledID, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default",
+		JobMetadata{Ref: "refs/heads/master", Scheduled: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.EnqueueJob(projectName, projectOwner, "cafebabe", "default",
+		JobMetadata{Ref: "refs/heads/master"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := conn.FindJob(scheduledID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !job.Scheduled {
+		t.Fatalf("Expected job %d to be scheduled", scheduledID)
+	}
+
+	jobs, err := conn.FindJobsForProject(job.Project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+	for _, j := range jobs {
+		if j.Scheduled != (j.ID == scheduledID) {
+			t.Fatalf("Expected only job %d to be scheduled, but job %d has scheduled %v", scheduledID, j.ID,
+				j.Scheduled)
+		}
+	}
+}
+
 func TestCreateOutputWriter(t *testing.T) {
 	projectName := "TestCreateOutputWriter"
 	projectOwner := "bcd"
 	commitID := "00bab10c"
 	jobName := "default"
 
-	writer, _, err := conn.CreateOutputWriter(projectName, projectOwner, commitID, jobName)
+	jobID, err := conn.EnqueueJob(projectName, projectOwner, commitID, jobName, JobMetadata{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -243,6 +368,11 @@ func TestCreateOutputWriter(t *testing.T) {
 		t.Fatal("Couldn't find job, even though it should have been created")
 	}
 
+	writer, err := conn.CreateOutputWriter(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	timestampNow := time.Now()
 	// Write a proper output tuple
 	messageID, err := writer("message", timestampNow.Format(time.RFC3339))
@@ -260,9 +390,543 @@ func TestCreateOutputWriter(t *testing.T) {
 	}
 
 	// Creating a second writer on the same job should be OK
-	_, _, err = conn.CreateOutputWriter(projectName, projectOwner, commitID, jobName)
+	_, err = conn.CreateOutputWriter(jobID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// Creating a writer for a job that doesn't exist should error
+	_, err = conn.CreateOutputWriter(jobID + 1000)
+	if err == nil {
+		t.Fatal("Expected an error while creating a writer for a job that doesn't exist")
+	}
+
+}
+
+func TestCreateSkippedJob(t *testing.T) {
+	projectName := "TestCreateSkippedJob"
+	projectOwner := "bcd"
+
+	jobID, err := conn.CreateSkippedJob(projectName, projectOwner, "deadbeef", "default",
+		JobMetadata{Ref: "refs/heads/master", Provider: "github"}, "Skipped, the commit message contains \"[skip ci]\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := conn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_SKIPPED) {
+		t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_SKIPPED), job.Status)
+	}
+	if job.Extra != "Skipped, the commit message contains \"[skip ci]\"" {
+		t.Fatalf("Expected the reason the job was skipped, got %q", job.Extra)
+	}
+	if job.Ref != "refs/heads/master" {
+		t.Fatalf("Expected ref %q, got %q", "refs/heads/master", job.Ref)
+	}
+	if job.QueuePosition != 0 {
+		t.Fatalf("Expected queue position 0 for a skipped job, got %d", job.QueuePosition)
+	}
+
+	// Skipped jobs are never queued
+	jobs, err := conn.FindQueuedJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range jobs {
+		if j.ID == jobID {
+			t.Fatal("Skipped job shouldn't have been queued")
+		}
+	}
+}
+
+func TestFindJobsForPullRequest(t *testing.T) {
+	// We should first create a project
+	projectName := "TestFindJobsForPullRequest"
+	projectOwner := "bcd"
+
+	projectID, err := conn.createProject(projectName, projectOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a job for a push, and two jobs for a pull request
+	_, err = conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", JobMetadata{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prJobID01, err := conn.EnqueueJob(projectName, projectOwner, "cafebabe", "default",
+		JobMetadata{PullRequest: 42, Ref: "refs/pull/42/head", Provider: "github"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prJobID02, err := conn.EnqueueJob(projectName, projectOwner, "c0ffee", "default",
+		JobMetadata{PullRequest: 42}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := conn.FindJobsForPullRequest(projectID, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs for pull request, got %d", len(jobs))
+	}
+	if jobs[0].ID != prJobID01 || jobs[1].ID != prJobID02 {
+		t.Fatalf("Expected job IDs %d and %d, got %d and %d", prJobID01, prJobID02, jobs[0].ID, jobs[1].ID)
+	}
+	if jobs[0].PullRequest != 42 {
+		t.Fatalf("Expected pull request 42, got %d", jobs[0].PullRequest)
+	}
+	if jobs[0].Provider != "github" || jobs[1].Provider != "" {
+		t.Fatalf("Expected providers %q and %q, got %q and %q", "github", "", jobs[0].Provider, jobs[1].Provider)
+	}
+
+	// All jobs should be returned when not filtering on pull request
+	jobs, err = conn.FindJobsForProject(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 jobs for project, got %d", len(jobs))
+	}
+
+	job, err := conn.FindJobWithData(prJobID01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.PullRequest != 42 {
+		t.Fatalf("Expected pull request 42, got %d", job.PullRequest)
+	}
+	if job.Ref != "refs/pull/42/head" {
+		t.Fatalf("Expected ref %q, got %q", "refs/pull/42/head", job.Ref)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	// Empty the queue, other tests might have queued jobs
+	for {
+		jobID, err := conn.DequeueJob()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jobID == -1 {
+			break
+		}
+	}
+
+	projectName := "TestQueue"
+	projectOwner := "bcd"
+
+	jobID01, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", JobMetadata{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID02, err := conn.EnqueueJob(projectName, projectOwner, "cafebabe", "default", JobMetadata{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := conn.FindQueuedJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected queue length 2, got %d", len(jobs))
+	}
+
+	// A full queue doesn't accept any more jobs, and no job is created for them
+	latestJobID := conn.GetLatestJobID()
+	_, err = conn.EnqueueJob(projectName, projectOwner, "c0ffee", "default", JobMetadata{}, 2)
+	if err != ErrQueueFull {
+		t.Fatalf("Expected error %q, got %v", ErrQueueFull, err)
+	}
+	if conn.GetLatestJobID() != latestJobID {
+		t.Fatal("Expected no job to be created when the queue is full")
+	}
+
+	// Both jobs should be queued, in the order they were created
+	jobs, err = conn.FindQueuedJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 queued jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != jobID01 || jobs[1].ID != jobID02 {
+		t.Fatalf("Expected queued job IDs %d and %d, got %d and %d", jobID01, jobID02, jobs[0].ID, jobs[1].ID)
+	}
+
+	job, err := conn.FindJob(jobID02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_QUEUED) {
+		t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_QUEUED), job.Status)
+	}
+	if job.QueuePosition != 2 {
+		t.Fatalf("Expected queue position 2, got %d", job.QueuePosition)
+	}
+
+	// Dequeueing should return the oldest job and set it to running
+	jobID, err := conn.DequeueJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobID != jobID01 {
+		t.Fatalf("Expected to dequeue job %d, got %d", jobID01, jobID)
+	}
+	job, err = conn.FindJob(jobID01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_RUNNING) {
+		t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_RUNNING), job.Status)
+	}
+	if job.QueuePosition != 0 {
+		t.Fatalf("Expected queue position 0 for a running job, got %d", job.QueuePosition)
+	}
+
+	// The second job moved up in the queue
+	job, err = conn.FindJob(jobID02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.QueuePosition != 1 {
+		t.Fatalf("Expected queue position 1, got %d", job.QueuePosition)
+	}
+
+	// Running jobs are interrupted, queued jobs are left alone
+	interrupted, err := conn.InterruptRunningJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, j := range interrupted {
+		if j.ID == jobID02 {
+			t.Fatal("Queued job shouldn't have been interrupted")
+		}
+		if j.ID == jobID01 {
+			found = true
+			if j.Status != statusToString(STATUS_ERROR) {
+				t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_ERROR), j.Status)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("Expected running job to be interrupted")
+	}
+
+	jobID, err = conn.DequeueJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobID != jobID02 {
+		t.Fatalf("Expected to dequeue job %d, got %d", jobID02, jobID)
+	}
+
+	// The queue is empty now
+	jobID, err = conn.DequeueJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobID != -1 {
+		t.Fatalf("Expected -1 when dequeueing from an empty queue, got %d", jobID)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	projectName := "TestCancelQueuedJob"
+	projectOwner := "bcd"
+	metadata := JobMetadata{Ref: "refs/heads/master", Provider: "github"}
+
+	// Unknown projects don't have active jobs
+	jobs, err := conn.FindActiveJobsForRef(projectName, projectOwner, metadata.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no active jobs, got %d", len(jobs))
+	}
+
+	jobID01, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", metadata, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID02, err := conn.EnqueueJob(projectName, projectOwner, "cafebabe", "default", metadata, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.EnqueueJob(projectName, projectOwner, "deadc0de", "default",
+		JobMetadata{Ref: "refs/heads/develop", Provider: "github"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.CreateSkippedJob(projectName, projectOwner, "c0ffee", "default", metadata, "Skipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the queued jobs of the ref are active
+	jobs, err = conn.FindActiveJobsForRef(projectName, projectOwner, metadata.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 active jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != jobID01 || jobs[1].ID != jobID02 {
+		t.Fatalf("Expected active job IDs %d and %d, got %d and %d", jobID01, jobID02, jobs[0].ID, jobs[1].ID)
+	}
+
+	cancelled, err := conn.CancelQueuedJob(jobID01, "Cancelled, superseded by job 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled {
+		t.Fatal("Expected queued job to be cancelled")
+	}
+	job, err := conn.FindJob(jobID01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_CANCELLED) {
+		t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_CANCELLED), job.Status)
+	}
+	if job.Extra != "Cancelled, superseded by job 2" {
+		t.Fatalf("Expected the reason the job was cancelled, got %q", job.Extra)
+	}
+	if job.QueuePosition != 0 {
+		t.Fatalf("Expected queue position 0 for a cancelled job, got %d", job.QueuePosition)
+	}
+
+	// A job that isn't queued can't be cancelled again
+	cancelled, err = conn.CancelQueuedJob(jobID01, "Cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled {
+		t.Fatal("Expected cancelled job not to be cancelled again")
+	}
+
+	jobs, err = conn.FindActiveJobsForRef(projectName, projectOwner, metadata.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != jobID02 {
+		t.Fatalf("Expected job %d to be the only active job, got %v", jobID02, jobs)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	projectName := "TestCancelRunningJob"
+	projectOwner := "bcd"
+
+	// Queued jobs aren't running
+	jobID, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", JobMetadata{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := conn.CancelRunningJob(jobID, "Cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled {
+		t.Fatal("Expected queued job not to be cancelled as a running job")
+	}
+
+	err = conn.UpdateJobStatus(jobID, STATUS_RUNNING, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err = conn.CancelRunningJob(jobID, "Cancelled by alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled {
+		t.Fatal("Expected running job to be cancelled")
+	}
+	job, err := conn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_CANCELLED) || job.Extra != "Cancelled by alice" {
+		t.Fatalf("Expected job status %q with reason %q, got %q with reason %q", statusToString(STATUS_CANCELLED),
+			"Cancelled by alice", job.Status, job.Extra)
+	}
+
+	// A job that finished before it could be stopped keeps its status
+	err = conn.UpdateJobStatus(jobID, STATUS_DONE, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err = conn.CancelRunningJob(jobID, "Cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled {
+		t.Fatal("Expected finished job not to be cancelled")
+	}
+	job, err = conn.FindJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != statusToString(STATUS_DONE) {
+		t.Fatalf("Expected job status %q, got %q", statusToString(STATUS_DONE), job.Status)
+	}
+}
+
+func TestHasJobForCommit(t *testing.T) {
+	projectName := "TestHasJobForCommit"
+	projectOwner := "bcd"
+	ref := "refs/tags/v1.0.0"
+
+	// Unknown projects don't have any jobs
+	built, err := conn.HasJobForCommit(projectName, projectOwner, ref, "deadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built {
+		t.Fatal("Expected no job for a project that doesn't exist")
+	}
+
+	jobID, err := conn.EnqueueJob(projectName, projectOwner, "deadbeef", "default", JobMetadata{Ref: ref}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ref, commitID string
+		expected      bool
+	}{
+		{ref, "deadbeef", true},
+		{ref, "cafebabe", false},
+		{"refs/heads/master", "deadbeef", false},
+	}
+	for _, c := range cases {
+		built, err = conn.HasJobForCommit(projectName, projectOwner, c.ref, c.commitID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if built != c.expected {
+			t.Errorf("Expected %v for commit %q of %q, got %v", c.expected, c.commitID, c.ref, built)
+		}
+	}
+
+	// Cancelled jobs don't count
+	_, err = conn.CancelQueuedJob(jobID, "Cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err = conn.HasJobForCommit(projectName, projectOwner, ref, "deadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built {
+		t.Fatal("Expected a cancelled job not to count")
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	headers.Set("X-GitHub-Event", "push")
+	headers.Set("Authorization", "Bearer secret")
+
+	delivery := Delivery{
+		DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		Event:      "push",
+		Headers:    headers,
+		Body:       `{"ref": "refs/heads/master"}`,
+		Signature:  "valid",
+		Outcome:    "Queued job 1",
+		Job:        1,
+		Received:   time.Now(),
+	}
+	id01, err := conn.CreateDelivery(delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivery.Outcome = "Ignored"
+	delivery.Job = 0
+	id02, err := conn.CreateDelivery(delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The most recent delivery is returned first
+	deliveries, err := conn.FindDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(deliveries))
+	}
+	if deliveries[0].ID != id02 || deliveries[1].ID != id01 {
+		t.Fatalf("Expected delivery IDs %d and %d, got %d and %d", id02, id01, deliveries[0].ID, deliveries[1].ID)
+	}
+	if deliveries[1].Job != 1 || deliveries[1].Outcome != "Queued job 1" {
+		t.Fatalf("Unexpected delivery %v", deliveries[1])
+	}
+
+	found, err := conn.FindDelivery(id01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Body != delivery.Body {
+		t.Fatalf("Expected body %q, got %q", delivery.Body, found.Body)
+	}
+	if found.Headers.Get("X-GitHub-Event") != "push" {
+		t.Fatalf("Expected event header %q, got %q", "push", found.Headers.Get("X-GitHub-Event"))
+	}
+	if found.Headers.Get("Authorization") != "" {
+		t.Fatalf("Expected the authorization header not to be stored, got %q", found.Headers.Get("Authorization"))
+	}
+
+	_, err = conn.FindDelivery(id02 + 1000)
+	if err == nil {
+		t.Fatal("Expected an error while finding a delivery that doesn't exist")
+	}
+
+	// Only the first delivery resulted in a job
+	accepted, err := conn.FindAcceptedDelivery(delivery.DeliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted == nil || accepted.ID != id01 {
+		t.Fatalf("Expected accepted delivery %d, got %v", id01, accepted)
+	}
+
+	accepted, err = conn.FindAcceptedDelivery("unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted != nil {
+		t.Fatalf("Expected no accepted delivery, got %v", accepted)
+	}
+}
+
+func TestJobActive(t *testing.T) {
+	cases := []struct {
+		status        JobStatus
+		expectedValue bool
+	}{
+		{STATUS_QUEUED, true},
+		{STATUS_RUNNING, true},
+		{STATUS_DONE, false},
+		{STATUS_ERROR, false},
+		{STATUS_SKIPPED, false},
+		{STATUS_CANCELLED, false},
+	}
+
+	for _, testCase := range cases {
+		job := Job{Status: statusToString(testCase.status)}
+		if job.Active() != testCase.expectedValue {
+			t.Errorf("Expected Active() to be %v for status %q", testCase.expectedValue, job.Status)
+		}
+	}
 }
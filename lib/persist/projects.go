@@ -2,6 +2,7 @@ package persist
 
 import (
 	"fmt"
+	log "github.com/Sirupsen/logrus"
 )
 
 // Project struct, fairly self-explanatory.
@@ -42,6 +43,25 @@ func (db *DB) createProject(name string, owner string) (int64, error) {
 	return id, nil
 }
 
+// Find the ID of a project, or create the project if it doesn't exist yet.
+func (db *DB) findOrCreateProject(name string, owner string) (int64, error) {
+	var err error
+	log.Debugf("Querying for project ID of project with name %q and owner %q", name, owner)
+	projectID := db.findProjectID(name, owner)
+
+	if projectID == -1 {
+		// Project isn't known in the database, so create it
+		log.Debugf("Project not found, creating")
+		projectID, err = db.createProject(name, owner)
+		if err != nil {
+			return -1, err
+		}
+	}
+	log.Debugf("Project has ID %d", projectID)
+
+	return projectID, nil
+}
+
 // FindAllProjects returns all the projects. Used for the webapi get "api/projects/".
 func (db *DB) FindAllProjects() (*[]Project, error) {
 	var results []Project
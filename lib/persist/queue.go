@@ -0,0 +1,268 @@
+package persist
+
+import (
+	"database/sql"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// ErrQueueFull is returned when a job isn't queued because the queue has reached its maximum length.
+var ErrQueueFull = errors.New("Build queue is full")
+
+/*
+EnqueueJob creates a new job with status "queued" and appends it to the queue. The project the job belongs to
+is created if it doesn't exist yet. When maxLength is greater than 0 and that many jobs are queued already, no job
+is created and ErrQueueFull is returned. The length of the queue is checked in the same transaction that queues the
+job, so concurrent deliveries can't exceed it.
+Returns the ID of the created job.
+*/
+func (db *DB) EnqueueJob(projectName string, projectOwner string, commitID string, job string,
+	metadata JobMetadata, maxLength int64) (int64, error) {
+	projectID, err := db.findOrCreateProject(projectName, projectOwner)
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return -1, err
+	}
+
+	if maxLength > 0 {
+		var length int64
+		err = tx.QueryRow("SELECT count(*) FROM Queue").Scan(&length)
+		if err != nil {
+			tx.Rollback()
+			return -1, err
+		}
+		if length >= maxLength {
+			tx.Rollback()
+			return -1, ErrQueueFull
+		}
+	}
+
+	// Always create a new job iteration
+	jobID, err := insertJob(tx, projectID, commitID, job, STATUS_QUEUED, "", metadata)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	_, err = tx.Exec("INSERT INTO Queue VALUES (?1, ?2)", jobID, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+	log.Debugf("Job with ID %d was queued", jobID)
+
+	return jobID, nil
+}
+
+/*
+DequeueJob removes the job that has been in the queue the longest and sets its status to "running".
+Returns the ID of that job, or -1 if the queue is empty.
+*/
+func (db *DB) DequeueJob() (int64, error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return -1, err
+	}
+
+	var jobID int64
+	err = tx.QueryRow("SELECT job FROM Queue ORDER BY id() ASC LIMIT 1").Scan(&jobID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return -1, nil
+	} else if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	_, err = tx.Exec("DELETE FROM Queue WHERE job = ?1", jobID)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	_, err = tx.Exec("UPDATE Jobs SET status = ?1 WHERE id() = ?2", statusToString(STATUS_RUNNING), jobID)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+	log.Debugf("Job with ID %d was dequeued", jobID)
+
+	return jobID, nil
+}
+
+/*
+CancelQueuedJob removes a job from the queue and sets its status to "cancelled".
+Returns false if the job wasn't queued, e.g. because a worker already dequeued it.
+*/
+func (db *DB) CancelQueuedJob(jobID int64, extra string) (bool, error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var queued int64
+	err = tx.QueryRow("SELECT count(*) FROM Queue WHERE job = ?1", jobID).Scan(&queued)
+	if err != nil || queued == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	_, err = tx.Exec("DELETE FROM Queue WHERE job = ?1", jobID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE Jobs SET status = ?1, extra = ?2 WHERE id() = ?3",
+		statusToString(STATUS_CANCELLED), extra, jobID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	log.Debugf("Job with ID %d was cancelled", jobID)
+
+	return true, nil
+}
+
+/*
+CancelRunningJob sets the status of a running job to "cancelled".
+Returns false if the job wasn't running anymore, e.g. because it finished before it could be stopped.
+*/
+func (db *DB) CancelRunningJob(jobID int64, extra string) (bool, error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM Jobs WHERE id() = ?1", jobID).Scan(&status)
+	if err != nil || status != statusToString(STATUS_RUNNING) {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		return false, err
+	}
+
+	_, err = tx.Exec("UPDATE Jobs SET status = ?1, extra = ?2 WHERE id() = ?3",
+		statusToString(STATUS_CANCELLED), extra, jobID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	log.Debugf("Job with ID %d was cancelled", jobID)
+
+	return true, nil
+}
+
+// FindQueuedJobs returns all queued jobs, in the order in which they will be executed.
+// Used for the webapi get "api/jobs/queue".
+func (db *DB) FindQueuedJobs() ([]Job, error) {
+	rows, err := db.Connection.Query("SELECT job FROM Queue ORDER BY id() ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobIDs []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for i, jobID := range jobIDs {
+		job, err := db.FindJob(jobID)
+		if err != nil {
+			return nil, err
+		}
+		job.QueuePosition = int64(i + 1)
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, nil
+}
+
+// Returns the position of a job in the queue, starting at 1. The return value will be 0 if the job isn't queued.
+func (db *DB) queuePosition(jobID int64) int64 {
+	var queueID *int64
+	_ = db.Connection.QueryRow("SELECT id() FROM Queue WHERE job = ?1", jobID).Scan(&queueID)
+	if queueID == nil {
+		return 0
+	}
+
+	var position int64
+	_ = db.Connection.QueryRow("SELECT count(*) FROM Queue WHERE id() <= ?1", *queueID).Scan(&position)
+
+	return position
+}
+
+/*
+InterruptRunningJobs sets the status of every job that is still running to "error". When octorunner starts no job
+can be running, so these are jobs that were interrupted when octorunner stopped.
+Returns the jobs that were interrupted.
+*/
+func (db *DB) InterruptRunningJobs() ([]Job, error) {
+	rows, err := db.Connection.Query("SELECT id() FROM Jobs WHERE status = ?1", statusToString(STATUS_RUNNING))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobIDs []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, jobID := range jobIDs {
+		err = db.UpdateJobStatus(jobID, STATUS_ERROR, "Job was interrupted because octorunner stopped")
+		if err != nil {
+			return nil, err
+		}
+		job, err := db.FindJob(jobID)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, nil
+}
@@ -11,12 +11,16 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
 	"golang.org/x/net/context"
 	"gopkg.in/yaml.v2"
 	"io"
 	"io/ioutil"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 /*
@@ -51,6 +55,7 @@ type ExecutionClient interface {
 	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
 	ContainerWait(ctx context.Context, containerID string) (int64, error)
 	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error
 	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
 	CopyToContainer(ctx context.Context, container, path string, content io.Reader, options types.CopyToContainerOptions) error
 	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
@@ -60,8 +65,7 @@ type ExecutionClient interface {
 PersistClient implementations provide a functions that are used to persist job data to a datastore.
 */
 type PersistClient interface {
-	CreateOutputWriter(projectName string, projectOwner string, commitID string,
-		job string) (func(string, string) (int64, error), int64, error)
+	CreateOutputWriter(jobID int64) (func(string, string) (int64, error), error)
 	UpdateJobStatus(jobID int64, status persist.JobStatus, extra string) error
 }
 
@@ -70,14 +74,76 @@ Pipeline contains an image name, and an array containing commands that are execu
 the pipeline is executed.
 When the pipeline is executed, the script array will be concatenated as a single script, of which every
 command needs to return 0 for the script to pass as successful.
+Tags decides whether the pipeline runs for tags, it can be left empty to run for both branches and tags,
+be set to "only" to exclusively run for tags, or be set to "ignore" to never run for tags.
+Branches decides which branches the pipeline runs for, and Paths decides which changed paths a push needs to
+contain for the pipeline to run.
+Checkout decides how the source of the repository is fetched.
 */
 type Pipeline struct {
-	Script []string `yaml:"script"`
-	Image  string   `yaml:"image"`
+	Script   []string   `yaml:"script"`
+	Image    string     `yaml:"image"`
+	Tags     string     `yaml:"tags"`
+	Branches Filter     `yaml:"branches"`
+	Paths    PathFilter `yaml:"paths"`
+	Checkout Checkout   `yaml:"checkout"`
+}
+
+/*
+Filter contains glob patterns, as matched by path.Match. In addition a "**" element matches any number of
+path elements. A name passes the filter when it matches one of the patterns in Only, or Only is empty, and
+it doesn't match any of the patterns in Except.
+*/
+type Filter struct {
+	Only   []string `yaml:"only"`
+	Except []string `yaml:"except"`
+}
+
+/*
+PathFilter is a Filter for the paths changed by a push. When ReportSkipped is set, the status of commits that
+are skipped because of the filter is set to success.
+*/
+type PathFilter struct {
+	Filter        `yaml:",inline"`
+	ReportSkipped bool `yaml:"report_skipped"`
+}
+
+/*
+Checkout describes how the source of a repository is fetched. Mode is either "archive", which downloads
+an archive of the commit without any git metadata, or "git", which checks out the commit in a git work tree.
+Depth limits the number of commits fetched in "git" mode, 0 fetches the complete history.
+Submodules recursively initialises the submodules of the repository, and LFS fetches the Git LFS objects of
+the repository. Both require "git" mode.
+*/
+type Checkout struct {
+	Mode       string `yaml:"mode"`
+	Depth      int    `yaml:"depth"`
+	Submodules bool   `yaml:"submodules"`
+	LFS        bool   `yaml:"lfs"`
 }
 
 const repositoryData string = "repositoryData"
 
+// The context key of the variables a job was created with, which are passed to its container.
+const jobVariables string = "jobVariables"
+
+// TagRefPrefix is the prefix of git refs that point to tags.
+const TagRefPrefix = "refs/tags/"
+
+// BranchRefPrefix is the prefix of git refs that point to branches.
+const BranchRefPrefix = "refs/heads/"
+
+const (
+	tagsOnly   = "only"
+	tagsIgnore = "ignore"
+)
+
+// Checkout modes
+const (
+	CheckoutArchive = "archive"
+	CheckoutGit     = "git"
+)
+
 /*
 ParseConfig deserializes .octorunner.y[a]ml files contained in code repositories.
 See https://github.com/boyvanduuren/octorunner#adding-a-test-to-your-repository.
@@ -89,17 +155,140 @@ func ParseConfig(file []byte) (Pipeline, error) {
 		return pipelineConfig, err
 	}
 
+	switch pipelineConfig.Tags {
+	case "", tagsOnly, tagsIgnore:
+	default:
+		return pipelineConfig, fmt.Errorf("Invalid value %q for tags, expected %q or %q",
+			pipelineConfig.Tags, tagsOnly, tagsIgnore)
+	}
+
+	for _, pattern := range append(pipelineConfig.Branches.Only, pipelineConfig.Branches.Except...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return pipelineConfig, fmt.Errorf("Invalid branch pattern %q: %v", pattern, err)
+		}
+	}
+	for _, pattern := range append(pipelineConfig.Paths.Only, pipelineConfig.Paths.Except...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return pipelineConfig, fmt.Errorf("Invalid path pattern %q: %v", pattern, err)
+		}
+	}
+
+	switch pipelineConfig.Checkout.Mode {
+	case "":
+		pipelineConfig.Checkout.Mode = CheckoutArchive
+	case CheckoutArchive, CheckoutGit:
+	default:
+		return pipelineConfig, fmt.Errorf("Invalid value %q for checkout mode, expected %q or %q",
+			pipelineConfig.Checkout.Mode, CheckoutArchive, CheckoutGit)
+	}
+	if pipelineConfig.Checkout.Depth < 0 {
+		return pipelineConfig, fmt.Errorf("Invalid value %d for checkout depth, expected 0 or more",
+			pipelineConfig.Checkout.Depth)
+	}
+	if (pipelineConfig.Checkout.Submodules || pipelineConfig.Checkout.LFS) &&
+		pipelineConfig.Checkout.Mode != CheckoutGit {
+		return pipelineConfig, fmt.Errorf("Submodules and LFS require checkout mode %q", CheckoutGit)
+	}
+
 	return pipelineConfig, nil
 }
 
+/*
+RunsForRef returns whether the pipeline should be executed for a git ref, e.g. "refs/heads/master"
+or "refs/tags/v1.0.0".
+*/
+func (c Pipeline) RunsForRef(ref string) bool {
+	if !c.RunsForBranch(ref) {
+		return false
+	}
+
+	isTag := strings.HasPrefix(ref, TagRefPrefix)
+	switch c.Tags {
+	case tagsOnly:
+		return isTag
+	case tagsIgnore:
+		return !isTag
+	}
+	return true
+}
+
+/*
+RunsForBranch returns whether the branch filters of the pipeline allow it to run for a git ref. Refs that
+don't point to a branch, like tags, always pass.
+*/
+func (c Pipeline) RunsForBranch(ref string) bool {
+	if !strings.HasPrefix(ref, BranchRefPrefix) {
+		return true
+	}
+	return c.Branches.Matches(strings.TrimPrefix(ref, BranchRefPrefix))
+}
+
+/*
+RunsForPaths returns whether the path filters of the pipeline allow it to run for a push that changed the
+given paths, which is the case when at least one of the paths passes the filters. When the changed paths
+are unknown, nil can be passed to always run the pipeline.
+*/
+func (c Pipeline) RunsForPaths(changedPaths []string) bool {
+	if changedPaths == nil {
+		return true
+	}
+	for _, changedPath := range changedPaths {
+		if c.Paths.Matches(changedPath) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Matches returns whether a name passes the filter.
+*/
+func (f Filter) Matches(name string) bool {
+	if len(f.Only) > 0 && !matchesAny(f.Only, name) {
+		return false
+	}
+	return !matchesAny(f.Except, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchElements(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match the elements of a name against the elements of a pattern, where "**" matches any number of elements.
+func matchElements(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElements(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], name[0]); !matched {
+		return false
+	}
+	return matchElements(pattern[1:], name[1:])
+}
+
 // Extracted repositories are mounted as volumes on containers to WORKDIR.
 const workDir = "/var/run/octorunner"
 
 /*
-Execute a pipeline, and return the exit code of its script.
+Execute a pipeline for the given job, and return the exit code of its script.
 */
 func (c Pipeline) Execute(ctx context.Context, cli ExecutionClient,
-	persistClient PersistClient) (int, error) {
+	persistClient PersistClient, jobID int64) (int, error) {
 	log.Info("Starting execution of pipeline")
 
 	// make sure we have a provider for output storage
@@ -111,12 +300,11 @@ func (c Pipeline) Execute(ctx context.Context, cli ExecutionClient,
 	if !ok {
 		return -1, errors.New("Error while reading context")
 	}
+	// Not every job has variables
+	variables, _ := ctx.Value(jobVariables).(map[string]string)
 
 	// get a writer that writes to the Output table in our database
-	repoOwner := strings.Split(repoData["fullName"], "/")[0]
-	repoName := strings.Split(repoData["fullName"], "/")[1]
-	commitID := repoData["commitId"]
-	writer, jobID, err := persistClient.CreateOutputWriter(repoName, repoOwner, commitID, "default")
+	writer, err := persistClient.CreateOutputWriter(jobID)
 	if err != nil {
 		return -1, err
 	}
@@ -137,8 +325,8 @@ func (c Pipeline) Execute(ctx context.Context, cli ExecutionClient,
 	}
 
 	// create the container
-	containerName := fmt.Sprintf("%s_%d", containerName(repoData["fullName"], repoData["commitId"]), jobID)
-	containerID, err := containerCreate(ctx, cli, c.Script, c.Image, containerName)
+	containerName := jobContainerName(repoData["fullName"], repoData["commitId"], jobID)
+	containerID, err := containerCreate(ctx, cli, c.Script, c.Image, containerName, jobEnvironment(repoData, variables))
 	if err != nil {
 		formatted_err := fmt.Errorf("Error while waiting running job: %q", err)
 		persistClient.UpdateJobStatus(jobID, persist.STATUS_ERROR, fmt.Sprintf("%v", formatted_err))
@@ -207,6 +395,35 @@ func (c Pipeline) Execute(ctx context.Context, cli ExecutionClient,
 	return inspectData.State.ExitCode, nil
 }
 
+// The time a container gets to exit after being asked to stop, before it's killed.
+const stopTimeout = 10 * time.Second
+
+/*
+StopJob stops the container of a job and removes it. A job that's stopped before its container was created
+doesn't have a container, in which case nothing is done.
+*/
+func StopJob(ctx context.Context, cli ExecutionClient, repoFullName string, commitID string, jobID int64) error {
+	containerName := jobContainerName(repoFullName, commitID, jobID)
+
+	log.Infof("Stopping container %q", containerName)
+	timeout := stopTimeout
+	err := cli.ContainerStop(ctx, containerName, &timeout)
+	if client.IsErrContainerNotFound(err) {
+		log.Debugf("Container %q doesn't exist, nothing to stop", containerName)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error while stopping container: %q", err)
+	}
+
+	log.Debugf("Removing container \"%s\"", containerName)
+	err = cli.ContainerRemove(ctx, containerName, types.ContainerRemoveOptions{RemoveVolumes: true})
+	if err != nil && !client.IsErrContainerNotFound(err) {
+		return fmt.Errorf("Error while removing container: %q", err)
+	}
+
+	return nil
+}
+
 /*
 Check whether a particular image is available on a Docker host. We need this information to
 decide whether or not to pull the image.
@@ -252,7 +469,7 @@ Create a container using imageName on a Docker host with the given commands pass
 Return the ID assigned to the container by Docker, or an error if something goes wrong.
 */
 func containerCreate(ctx context.Context, cli ContainerCreater, commands []string, imageName string,
-	containerName string) (string, error) {
+	containerName string, env []string) (string, error) {
 	// create the container
 	script := strings.Join(commands, " && ")
 	log.Debugf("Creating container with entrypoint %q", script)
@@ -260,7 +477,8 @@ func containerCreate(ctx context.Context, cli ContainerCreater, commands []strin
 		&container.Config{
 			Image:      imageName,
 			Entrypoint: strslice.StrSlice{"/bin/sh", "-c", script},
-			WorkingDir: workDir},
+			WorkingDir: workDir,
+			Env:        env},
 		&container.HostConfig{AutoRemove: false},
 		&network.NetworkingConfig{},
 		containerName)
@@ -281,6 +499,32 @@ func containerCreate(ctx context.Context, cli ContainerCreater, commands []strin
 	return container.ID, nil
 }
 
+/*
+Environment variables that are set in the container of a job, so scripts know what they are running for.
+OCTORUNNER_TAG is only set when the job runs for a tag. The variables of the job come first, sorted by name,
+so they can't override the variables set by octorunner.
+*/
+func jobEnvironment(repoData map[string]string, variables map[string]string) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := []string{}
+	for _, name := range names {
+		env = append(env, name+"="+variables[name])
+	}
+	env = append(env, "OCTORUNNER_COMMIT="+repoData["commitId"])
+	if ref, exists := repoData["ref"]; exists {
+		env = append(env, "OCTORUNNER_REF="+ref)
+		if strings.HasPrefix(ref, TagRefPrefix) {
+			env = append(env, "OCTORUNNER_TAG="+strings.TrimPrefix(ref, TagRefPrefix))
+		}
+	}
+	return env
+}
+
 /*
 LogOutput checks a running container for log messages and passes messages with timestamps to a writer.
 */
@@ -326,6 +570,11 @@ func logOutput(ctx context.Context, cli ExecutionClient, containerID string,
 	return nil
 }
 
+// Returns the name of the container a job runs in.
+func jobContainerName(repoFullName string, commitID string, jobID int64) string {
+	return fmt.Sprintf("%s_%d", containerName(repoFullName, commitID), jobID)
+}
+
 /*
 Container names need to match [a-zA-Z_.-], so filter out everything that doesn't match.
 Except "-", which is translated to "_".
@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestConfigParsing(t *testing.T) {
@@ -53,6 +54,227 @@ script:
 	if err == nil {
 		t.Fail()
 	}
+
+	yaml = `
+image: alpine:latest
+tags: sometimes
+`
+	_, err = ParseConfig([]byte(yaml))
+	if err == nil {
+		t.Fatal("Expected an error for an invalid tags value")
+	}
+}
+
+func TestCheckoutConfig(t *testing.T) {
+	config, err := ParseConfig([]byte("image: alpine:latest\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Checkout.Mode != CheckoutArchive {
+		t.Fatalf("Expected checkout mode to default to %q, got %q", CheckoutArchive, config.Checkout.Mode)
+	}
+
+	yaml := `
+image: alpine:latest
+checkout:
+  mode: git
+  depth: 50
+`
+	config, err = ParseConfig([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Checkout.Mode != CheckoutGit || config.Checkout.Depth != 50 {
+		t.Fatalf("Expected a git checkout with depth 50, got %+v", config.Checkout)
+	}
+
+	yaml = `
+checkout:
+  mode: git
+  submodules: true
+  lfs: true
+`
+	config, err = ParseConfig([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !config.Checkout.Submodules || !config.Checkout.LFS {
+		t.Fatalf("Expected submodules and LFS to be enabled, got %+v", config.Checkout)
+	}
+
+	for _, yaml := range []string{
+		"checkout:\n  mode: svn\n",
+		"checkout:\n  mode: git\n  depth: -1\n",
+		"checkout:\n  submodules: true\n",
+		"checkout:\n  mode: archive\n  lfs: true\n",
+	} {
+		_, err = ParseConfig([]byte(yaml))
+		if err == nil {
+			t.Fatalf("Expected an error for %q", yaml)
+		}
+	}
+}
+
+func TestRunsForRef(t *testing.T) {
+	cases := []struct {
+		tags          string
+		ref           string
+		expectedValue bool
+	}{
+		{tags: "", ref: "refs/heads/master", expectedValue: true},
+		{tags: "", ref: "refs/tags/v1.2.0", expectedValue: true},
+		{tags: "only", ref: "refs/heads/master", expectedValue: false},
+		{tags: "only", ref: "refs/tags/v1.2.0", expectedValue: true},
+		{tags: "ignore", ref: "refs/heads/master", expectedValue: true},
+		{tags: "ignore", ref: "refs/tags/v1.2.0", expectedValue: false},
+	}
+
+	for _, testCase := range cases {
+		val := Pipeline{Tags: testCase.tags}.RunsForRef(testCase.ref)
+		if testCase.expectedValue != val {
+			t.Errorf("Expected %t for tags %q and ref %q, but got %t", testCase.expectedValue, testCase.tags,
+				testCase.ref, val)
+		}
+	}
+}
+
+func TestRunsForBranch(t *testing.T) {
+	branches := Filter{
+		Only:   []string{"master", "feature/*", "release-*"},
+		Except: []string{"release-old*"},
+	}
+	cases := []struct {
+		branches      Filter
+		ref           string
+		expectedValue bool
+	}{
+		{branches: Filter{}, ref: "refs/heads/gh-pages", expectedValue: true},
+		{branches: Filter{Except: []string{"gh-pages"}}, ref: "refs/heads/gh-pages", expectedValue: false},
+		{branches: Filter{Except: []string{"gh-pages"}}, ref: "refs/heads/master", expectedValue: true},
+		{branches: branches, ref: "refs/heads/master", expectedValue: true},
+		{branches: branches, ref: "refs/heads/feature/login", expectedValue: true},
+		{branches: branches, ref: "refs/heads/feature/login/fix", expectedValue: false},
+		{branches: branches, ref: "refs/heads/release-1.0", expectedValue: true},
+		{branches: branches, ref: "refs/heads/release-old-1.0", expectedValue: false},
+		{branches: branches, ref: "refs/heads/gh-pages", expectedValue: false},
+		{branches: branches, ref: "refs/tags/v1.2.0", expectedValue: true},
+		{branches: branches, ref: "refs/pull/12/head", expectedValue: true},
+	}
+
+	for _, testCase := range cases {
+		config := Pipeline{Branches: testCase.branches}
+		if val := config.RunsForBranch(testCase.ref); testCase.expectedValue != val {
+			t.Errorf("Expected %t for branches %+v and ref %q, but got %t", testCase.expectedValue,
+				testCase.branches, testCase.ref, val)
+		}
+		if val := config.RunsForRef(testCase.ref); testCase.expectedValue != val {
+			t.Errorf("Expected RunsForRef to return %t for branches %+v and ref %q, but got %t",
+				testCase.expectedValue, testCase.branches, testCase.ref, val)
+		}
+	}
+
+	_, err := ParseConfig([]byte("branches:\n  only:\n    - \"feature/[\"\n"))
+	if err == nil {
+		t.Fatal("Expected an error for an invalid branch pattern")
+	}
+}
+
+func TestRunsForPaths(t *testing.T) {
+	yaml := `
+image: alpine:latest
+paths:
+  only:
+    - "src/**"
+    - Makefile
+  except:
+    - "**/*.md"
+  report_skipped: true
+`
+	config, err := ParseConfig([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !config.Paths.ReportSkipped {
+		t.Fatal("Expected report_skipped to be set")
+	}
+
+	cases := []struct {
+		paths         []string
+		expectedValue bool
+	}{
+		{paths: nil, expectedValue: true},
+		{paths: []string{}, expectedValue: false},
+		{paths: []string{"Makefile"}, expectedValue: true},
+		{paths: []string{"src/main.go"}, expectedValue: true},
+		{paths: []string{"src/cmd/tool/main.go"}, expectedValue: true},
+		{paths: []string{"src/README.md"}, expectedValue: false},
+		{paths: []string{"docs/index.html", "README.md"}, expectedValue: false},
+		{paths: []string{"docs/index.html", "src/lib.go"}, expectedValue: true},
+	}
+
+	for _, testCase := range cases {
+		if val := config.RunsForPaths(testCase.paths); testCase.expectedValue != val {
+			t.Errorf("Expected %t for paths %v, but got %t", testCase.expectedValue, testCase.paths, val)
+		}
+	}
+
+	if !(Pipeline{}).RunsForPaths([]string{"docs/index.html"}) {
+		t.Fatal("Expected a pipeline without path filters to run for any path")
+	}
+
+	_, err = ParseConfig([]byte("paths:\n  except:\n    - \"docs/[\"\n"))
+	if err == nil {
+		t.Fatal("Expected an error for an invalid path pattern")
+	}
+}
+
+func TestJobEnvironment(t *testing.T) {
+	cases := []struct {
+		repoData      map[string]string
+		variables     map[string]string
+		expectedValue []string
+	}{
+		{
+			repoData: map[string]string{
+				"commitId": "deadbeef",
+			},
+			expectedValue: []string{"OCTORUNNER_COMMIT=deadbeef"},
+		},
+		{
+			repoData: map[string]string{
+				"commitId": "deadbeef",
+				"ref":      "refs/heads/master",
+			},
+			expectedValue: []string{"OCTORUNNER_COMMIT=deadbeef", "OCTORUNNER_REF=refs/heads/master"},
+		},
+		{
+			repoData: map[string]string{
+				"commitId": "deadbeef",
+				"ref":      "refs/tags/v1.2.0",
+			},
+			expectedValue: []string{"OCTORUNNER_COMMIT=deadbeef", "OCTORUNNER_REF=refs/tags/v1.2.0",
+				"OCTORUNNER_TAG=v1.2.0"},
+		},
+		{
+			repoData: map[string]string{
+				"commitId": "deadbeef",
+			},
+			variables: map[string]string{
+				"TARGET":            "staging",
+				"DEPLOY":            "true",
+				"OCTORUNNER_COMMIT": "cafebabe",
+			},
+			expectedValue: []string{"DEPLOY=true", "OCTORUNNER_COMMIT=cafebabe", "TARGET=staging",
+				"OCTORUNNER_COMMIT=deadbeef"},
+		},
+	}
+
+	for _, testCase := range cases {
+		val := jobEnvironment(testCase.repoData, testCase.variables)
+		if !reflect.DeepEqual(testCase.expectedValue, val) {
+			t.Errorf("Expected %v, but got %v", testCase.expectedValue, val)
+		}
+	}
 }
 
 // todo: this test now depends on a working docker host set in the environment, we need to mock this
@@ -261,7 +483,7 @@ func TestContainerCreate(t *testing.T) {
 
 	for _, testCase := range cases {
 		val, err := containerCreate(context.TODO(), testCase.c, []string{"true"}, "golang:latest",
-			"boyvanduuren_octorunner-1234")
+			"boyvanduuren_octorunner-1234", []string{})
 		if !reflect.DeepEqual(err, testCase.expectedError) {
 			t.Errorf("Expected err to be %q, but it was %q", testCase.expectedError, err)
 		}
@@ -282,7 +504,11 @@ type MockPipelineExecutionClient struct {
 	WaitErr    error
 	InspectErr error
 	ExitCode   int
+	StopErr    error
 	RemoveErr  error
+	// The containers that were stopped and removed
+	Stopped *[]string
+	Removed *[]string
 }
 
 func (client MockPipelineExecutionClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
@@ -332,7 +558,17 @@ func (client MockPipelineExecutionClient) ContainerInspect(ctx context.Context,
 	return types.ContainerJSON{}, client.InspectErr
 }
 
+func (client MockPipelineExecutionClient) ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error {
+	if client.Stopped != nil {
+		*client.Stopped = append(*client.Stopped, containerID)
+	}
+	return client.StopErr
+}
+
 func (client MockPipelineExecutionClient) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	if client.Removed != nil {
+		*client.Removed = append(*client.Removed, containerID)
+	}
 	return client.RemoveErr
 }
 
@@ -354,11 +590,10 @@ func (client MockPipelineExecutionClient) ContainerLogs(ctx context.Context, con
 
 type noopPersistClient struct{}
 
-func (persistClient noopPersistClient) CreateOutputWriter(projectName string, projectOwner string, commitID string,
-	job string) (func(string, string) (int64, error), int64, error) {
+func (persistClient noopPersistClient) CreateOutputWriter(jobID int64) (func(string, string) (int64, error), error) {
 	return func(foo, bar string) (int64, error) {
 		return 1, nil
-	}, 0, nil
+	}, nil
 }
 func (persistClient noopPersistClient) UpdateJobStatus(jobID int64, status persist.JobStatus, extra string) error {
 	return nil
@@ -581,7 +816,7 @@ func TestPipelineExecute(t *testing.T) {
 	}
 
 	for _, testCase := range cases {
-		val, err := testCase.p.Execute(testCase.ctx, testCase.c, noopPersistClient{})
+		val, err := testCase.p.Execute(testCase.ctx, testCase.c, noopPersistClient{}, 0)
 		if !reflect.DeepEqual(err, testCase.expectedError) {
 			t.Errorf("Expected err to be %q, but it was %q", testCase.expectedError, err)
 		}
@@ -616,3 +851,77 @@ func TestContainerName(t *testing.T) {
 		}
 	}
 }
+
+// Mimics the error the Docker client returns for containers that don't exist.
+type containerNotFoundError struct{}
+
+func (containerNotFoundError) Error() string {
+	return "Error: No such container"
+}
+
+func (containerNotFoundError) NotFound() bool {
+	return true
+}
+
+func TestStopJob(t *testing.T) {
+	cases := []struct {
+		c               MockPipelineExecutionClient
+		expectedRemoved int
+		expectedError   error
+	}{
+		// The container is stopped and removed
+		{
+			c:               MockPipelineExecutionClient{},
+			expectedRemoved: 1,
+			expectedError:   nil,
+		},
+		// The job didn't get a container
+		{
+			c: MockPipelineExecutionClient{
+				StopErr: containerNotFoundError{},
+			},
+			expectedRemoved: 0,
+			expectedError:   nil,
+		},
+		// The container couldn't be stopped
+		{
+			c: MockPipelineExecutionClient{
+				StopErr: errors.New("Stop error"),
+			},
+			expectedRemoved: 0,
+			expectedError:   fmt.Errorf("Error while stopping container: %q", "Stop error"),
+		},
+		// The container was removed in the meantime
+		{
+			c: MockPipelineExecutionClient{
+				RemoveErr: containerNotFoundError{},
+			},
+			expectedRemoved: 1,
+			expectedError:   nil,
+		},
+		// The container couldn't be removed
+		{
+			c: MockPipelineExecutionClient{
+				RemoveErr: errors.New("Remove error"),
+			},
+			expectedRemoved: 1,
+			expectedError:   fmt.Errorf("Error while removing container: %q", "Remove error"),
+		},
+	}
+
+	for _, testCase := range cases {
+		stopped, removed := []string{}, []string{}
+		testCase.c.Stopped, testCase.c.Removed = &stopped, &removed
+
+		err := StopJob(context.Background(), testCase.c, "boyvanduuren/octorunner", "deadbeef", 12)
+		if !reflect.DeepEqual(err, testCase.expectedError) {
+			t.Errorf("Expected err to be %q, but it was %q", testCase.expectedError, err)
+		}
+		if len(stopped) != 1 || stopped[0] != "boyvanduuren_octorunner-deadbeef_12" {
+			t.Errorf("Expected container %q to be stopped, got %v", "boyvanduuren_octorunner-deadbeef_12", stopped)
+		}
+		if len(removed) != testCase.expectedRemoved {
+			t.Errorf("Expected %d removed containers, got %v", testCase.expectedRemoved, removed)
+		}
+	}
+}
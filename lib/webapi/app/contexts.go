@@ -17,6 +17,286 @@ import (
 	"strconv"
 )
 
+// ListDeliveryContext provides the delivery list action context.
+type ListDeliveryContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+}
+
+// NewListDeliveryContext parses the incoming request URL and body, performs validations and creates the
+// context used by the delivery controller list action.
+func NewListDeliveryContext(ctx context.Context, r *http.Request, service *goa.Service) (*ListDeliveryContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := ListDeliveryContext{Context: ctx, ResponseData: resp, RequestData: req}
+	return &rctx, err
+}
+
+// OKLight sends a HTTP response with status code 200.
+func (ctx *ListDeliveryContext) OKLight(r OctorunnerDeliveryLightCollection) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.delivery+json; type=collection")
+	if r == nil {
+		r = OctorunnerDeliveryLightCollection{}
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// ReplayDeliveryContext provides the delivery replay action context.
+type ReplayDeliveryContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	DeliveryID int
+	Force      bool
+}
+
+// NewReplayDeliveryContext parses the incoming request URL and body, performs validations and creates the
+// context used by the delivery controller replay action.
+func NewReplayDeliveryContext(ctx context.Context, r *http.Request, service *goa.Service) (*ReplayDeliveryContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := ReplayDeliveryContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramDeliveryID := req.Params["deliveryID"]
+	if len(paramDeliveryID) > 0 {
+		rawDeliveryID := paramDeliveryID[0]
+		if deliveryID, err2 := strconv.Atoi(rawDeliveryID); err2 == nil {
+			rctx.DeliveryID = deliveryID
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("deliveryID", rawDeliveryID, "integer"))
+		}
+	}
+	paramForce := req.Params["force"]
+	if len(paramForce) == 0 {
+		rctx.Force = false
+	} else {
+		rawForce := paramForce[0]
+		if force, err2 := strconv.ParseBool(rawForce); err2 == nil {
+			rctx.Force = force
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("force", rawForce, "boolean"))
+		}
+	}
+	return &rctx, err
+}
+
+// OK sends a HTTP response with status code 200.
+func (ctx *ReplayDeliveryContext) OK(r *OctorunnerDelivery) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.delivery+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// OKLight sends a HTTP response with status code 200.
+func (ctx *ReplayDeliveryContext) OKLight(r *OctorunnerDeliveryLight) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.delivery+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *ReplayDeliveryContext) NotFound() error {
+	ctx.ResponseData.WriteHeader(404)
+	return nil
+}
+
+// ShowDeliveryContext provides the delivery show action context.
+type ShowDeliveryContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	DeliveryID int
+}
+
+// NewShowDeliveryContext parses the incoming request URL and body, performs validations and creates the
+// context used by the delivery controller show action.
+func NewShowDeliveryContext(ctx context.Context, r *http.Request, service *goa.Service) (*ShowDeliveryContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := ShowDeliveryContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramDeliveryID := req.Params["deliveryID"]
+	if len(paramDeliveryID) > 0 {
+		rawDeliveryID := paramDeliveryID[0]
+		if deliveryID, err2 := strconv.Atoi(rawDeliveryID); err2 == nil {
+			rctx.DeliveryID = deliveryID
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("deliveryID", rawDeliveryID, "integer"))
+		}
+	}
+	return &rctx, err
+}
+
+// OK sends a HTTP response with status code 200.
+func (ctx *ShowDeliveryContext) OK(r *OctorunnerDelivery) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.delivery+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// OKLight sends a HTTP response with status code 200.
+func (ctx *ShowDeliveryContext) OKLight(r *OctorunnerDeliveryLight) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.delivery+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *ShowDeliveryContext) NotFound() error {
+	ctx.ResponseData.WriteHeader(404)
+	return nil
+}
+
+// CancelJobContext provides the job cancel action context.
+type CancelJobContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	JobID int
+	By    *string
+}
+
+// NewCancelJobContext parses the incoming request URL and body, performs validations and creates the
+// context used by the job controller cancel action.
+func NewCancelJobContext(ctx context.Context, r *http.Request, service *goa.Service) (*CancelJobContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := CancelJobContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramJobID := req.Params["jobID"]
+	if len(paramJobID) > 0 {
+		rawJobID := paramJobID[0]
+		if jobID, err2 := strconv.Atoi(rawJobID); err2 == nil {
+			rctx.JobID = jobID
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("jobID", rawJobID, "integer"))
+		}
+	}
+	paramBy := req.Params["by"]
+	if len(paramBy) > 0 {
+		rawBy := paramBy[0]
+		rctx.By = &rawBy
+	}
+	return &rctx, err
+}
+
+// Accepted sends a HTTP response with status code 202.
+func (ctx *CancelJobContext) Accepted(r *OctorunnerJob) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
+// AcceptedLight sends a HTTP response with status code 202.
+func (ctx *CancelJobContext) AcceptedLight(r *OctorunnerJobLight) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *CancelJobContext) NotFound() error {
+	ctx.ResponseData.WriteHeader(404)
+	return nil
+}
+
+// Conflict sends a HTTP response with status code 409.
+func (ctx *CancelJobContext) Conflict(r error) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	return ctx.ResponseData.Service.Send(ctx.Context, 409, r)
+}
+
+// QueueJobContext provides the job queue action context.
+type QueueJobContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+}
+
+// NewQueueJobContext parses the incoming request URL and body, performs validations and creates the
+// context used by the job controller queue action.
+func NewQueueJobContext(ctx context.Context, r *http.Request, service *goa.Service) (*QueueJobContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := QueueJobContext{Context: ctx, ResponseData: resp, RequestData: req}
+	return &rctx, err
+}
+
+// OKLight sends a HTTP response with status code 200.
+func (ctx *QueueJobContext) OKLight(r OctorunnerJobLightCollection) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json; type=collection")
+	if r == nil {
+		r = OctorunnerJobLightCollection{}
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// RetryJobContext provides the job retry action context.
+type RetryJobContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	JobID int
+}
+
+// NewRetryJobContext parses the incoming request URL and body, performs validations and creates the
+// context used by the job controller retry action.
+func NewRetryJobContext(ctx context.Context, r *http.Request, service *goa.Service) (*RetryJobContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := RetryJobContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramJobID := req.Params["jobID"]
+	if len(paramJobID) > 0 {
+		rawJobID := paramJobID[0]
+		if jobID, err2 := strconv.Atoi(rawJobID); err2 == nil {
+			rctx.JobID = jobID
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("jobID", rawJobID, "integer"))
+		}
+	}
+	return &rctx, err
+}
+
+// Accepted sends a HTTP response with status code 202.
+func (ctx *RetryJobContext) Accepted(r *OctorunnerJob) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
+// AcceptedLight sends a HTTP response with status code 202.
+func (ctx *RetryJobContext) AcceptedLight(r *OctorunnerJobLight) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json")
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *RetryJobContext) NotFound() error {
+	ctx.ResponseData.WriteHeader(404)
+	return nil
+}
+
+// Conflict sends a HTTP response with status code 409.
+func (ctx *RetryJobContext) Conflict(r error) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	return ctx.ResponseData.Service.Send(ctx.Context, 409, r)
+}
+
+// ServiceUnavailable sends a HTTP response with status code 503.
+func (ctx *RetryJobContext) ServiceUnavailable() error {
+	ctx.ResponseData.WriteHeader(503)
+	return nil
+}
+
 // ShowJobContext provides the job show action context.
 type ShowJobContext struct {
 	context.Context
@@ -101,12 +381,70 @@ func (ctx *ShowLatestJobContext) NotFound() error {
 	return nil
 }
 
+// BuildProjectContext provides the project build action context.
+type BuildProjectContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	ProjectID int
+	Payload   *BuildPayload
+}
+
+// NewBuildProjectContext parses the incoming request URL and body, performs validations and creates the
+// context used by the project controller build action.
+func NewBuildProjectContext(ctx context.Context, r *http.Request, service *goa.Service) (*BuildProjectContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := BuildProjectContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramProjectID := req.Params["projectID"]
+	if len(paramProjectID) > 0 {
+		rawProjectID := paramProjectID[0]
+		if projectID, err2 := strconv.Atoi(rawProjectID); err2 == nil {
+			rctx.ProjectID = projectID
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("projectID", rawProjectID, "integer"))
+		}
+	}
+	return &rctx, err
+}
+
+// AcceptedLight sends a HTTP response with status code 202.
+func (ctx *BuildProjectContext) AcceptedLight(r OctorunnerJobLightCollection) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.octorunner.job+json; type=collection")
+	if r == nil {
+		r = OctorunnerJobLightCollection{}
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
+// BadRequest sends a HTTP response with status code 400.
+func (ctx *BuildProjectContext) BadRequest(r error) error {
+	ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	return ctx.ResponseData.Service.Send(ctx.Context, 400, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *BuildProjectContext) NotFound() error {
+	ctx.ResponseData.WriteHeader(404)
+	return nil
+}
+
+// ServiceUnavailable sends a HTTP response with status code 503.
+func (ctx *BuildProjectContext) ServiceUnavailable() error {
+	ctx.ResponseData.WriteHeader(503)
+	return nil
+}
+
 // JobsProjectContext provides the project jobs action context.
 type JobsProjectContext struct {
 	context.Context
 	*goa.ResponseData
 	*goa.RequestData
-	ProjectID int
+	ProjectID   int
+	PullRequest *int
 }
 
 // NewJobsProjectContext parses the incoming request URL and body, performs validations and creates the
@@ -127,6 +465,17 @@ func NewJobsProjectContext(ctx context.Context, r *http.Request, service *goa.Se
 			err = goa.MergeErrors(err, goa.InvalidParamTypeError("projectID", rawProjectID, "integer"))
 		}
 	}
+	paramPullRequest := req.Params["pullRequest"]
+	if len(paramPullRequest) > 0 {
+		rawPullRequest := paramPullRequest[0]
+		if pullRequest, err2 := strconv.Atoi(rawPullRequest); err2 == nil {
+			tmp7 := pullRequest
+			tmp6 := &tmp7
+			rctx.PullRequest = tmp6
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("pullRequest", rawPullRequest, "integer"))
+		}
+	}
 	return &rctx, err
 }
 
@@ -27,9 +27,71 @@ func initService(service *goa.Service) {
 	service.Decoder.Register(goa.NewJSONDecoder, "*/*")
 }
 
+// DeliveryController is the controller interface for the Delivery actions.
+type DeliveryController interface {
+	goa.Muxer
+	List(*ListDeliveryContext) error
+	Replay(*ReplayDeliveryContext) error
+	Show(*ShowDeliveryContext) error
+}
+
+// MountDeliveryController "mounts" a Delivery resource controller on the given service.
+func MountDeliveryController(service *goa.Service, ctrl DeliveryController) {
+	initService(service)
+	var h goa.Handler
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewListDeliveryContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.List(rctx)
+	}
+	service.Mux.Handle("GET", "/api/deliveries", ctrl.MuxHandler("List", h, nil))
+	service.LogInfo("mount", "ctrl", "Delivery", "action", "List", "route", "GET /api/deliveries")
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewReplayDeliveryContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Replay(rctx)
+	}
+	service.Mux.Handle("POST", "/api/deliveries/:deliveryID/replay", ctrl.MuxHandler("Replay", h, nil))
+	service.LogInfo("mount", "ctrl", "Delivery", "action", "Replay", "route", "POST /api/deliveries/:deliveryID/replay")
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewShowDeliveryContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Show(rctx)
+	}
+	service.Mux.Handle("GET", "/api/deliveries/:deliveryID", ctrl.MuxHandler("Show", h, nil))
+	service.LogInfo("mount", "ctrl", "Delivery", "action", "Show", "route", "GET /api/deliveries/:deliveryID")
+}
+
 // JobController is the controller interface for the Job actions.
 type JobController interface {
 	goa.Muxer
+	Cancel(*CancelJobContext) error
+	Queue(*QueueJobContext) error
+	Retry(*RetryJobContext) error
 	Show(*ShowJobContext) error
 	ShowLatest(*ShowLatestJobContext) error
 }
@@ -39,6 +101,51 @@ func MountJobController(service *goa.Service, ctrl JobController) {
 	initService(service)
 	var h goa.Handler
 
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewCancelJobContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Cancel(rctx)
+	}
+	service.Mux.Handle("POST", "/api/jobs/:jobID/cancel", ctrl.MuxHandler("Cancel", h, nil))
+	service.LogInfo("mount", "ctrl", "Job", "action", "Cancel", "route", "POST /api/jobs/:jobID/cancel")
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewQueueJobContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Queue(rctx)
+	}
+	service.Mux.Handle("GET", "/api/jobs/queue", ctrl.MuxHandler("Queue", h, nil))
+	service.LogInfo("mount", "ctrl", "Job", "action", "Queue", "route", "GET /api/jobs/queue")
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewRetryJobContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Retry(rctx)
+	}
+	service.Mux.Handle("POST", "/api/jobs/:jobID/retry", ctrl.MuxHandler("Retry", h, nil))
+	service.LogInfo("mount", "ctrl", "Job", "action", "Retry", "route", "POST /api/jobs/:jobID/retry")
+
 	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		// Check if there was an error loading the request
 		if err := goa.ContextError(ctx); err != nil {
@@ -73,6 +180,7 @@ func MountJobController(service *goa.Service, ctrl JobController) {
 // ProjectController is the controller interface for the Project actions.
 type ProjectController interface {
 	goa.Muxer
+	Build(*BuildProjectContext) error
 	Jobs(*JobsProjectContext) error
 	List(*ListProjectContext) error
 	Show(*ShowProjectContext) error
@@ -83,6 +191,27 @@ func MountProjectController(service *goa.Service, ctrl ProjectController) {
 	initService(service)
 	var h goa.Handler
 
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewBuildProjectContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		// Build the payload
+		if rawPayload := goa.ContextRequest(ctx).Payload; rawPayload != nil {
+			rctx.Payload = rawPayload.(*BuildPayload)
+		} else {
+			return goa.MissingPayloadError()
+		}
+		return ctrl.Build(rctx)
+	}
+	service.Mux.Handle("POST", "/api/projects/:projectID/builds", ctrl.MuxHandler("Build", h, unmarshalBuildProjectPayload))
+	service.LogInfo("mount", "ctrl", "Project", "action", "Build", "route", "POST /api/projects/:projectID/builds")
+
 	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		// Check if there was an error loading the request
 		if err := goa.ContextError(ctx); err != nil {
@@ -128,3 +257,13 @@ func MountProjectController(service *goa.Service, ctrl ProjectController) {
 	service.Mux.Handle("GET", "/api/projects/:projectID", ctrl.MuxHandler("Show", h, nil))
 	service.LogInfo("mount", "ctrl", "Project", "action", "Show", "route", "GET /api/projects/:projectID")
 }
+
+// unmarshalBuildProjectPayload unmarshals the request body into the context request data Payload field.
+func unmarshalBuildProjectPayload(ctx context.Context, service *goa.Service, req *http.Request) error {
+	payload := &buildPayload{}
+	if err := service.DecodeRequest(req, payload); err != nil {
+		return err
+	}
+	goa.ContextRequest(ctx).Payload = payload.Publicize()
+	return nil
+}
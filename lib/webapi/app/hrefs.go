@@ -15,6 +15,12 @@ import (
 	"strings"
 )
 
+// DeliveryHref returns the resource href.
+func DeliveryHref(deliveryID interface{}) string {
+	paramdeliveryID := strings.TrimLeftFunc(fmt.Sprintf("%v", deliveryID), func(r rune) bool { return r == '/' })
+	return fmt.Sprintf("/api/deliveries/%v", paramdeliveryID)
+}
+
 // JobHref returns the resource href.
 func JobHref(jobID interface{}) string {
 	paramjobID := strings.TrimLeftFunc(fmt.Sprintf("%v", jobID), func(r rune) bool { return r == '/' })
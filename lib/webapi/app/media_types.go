@@ -15,6 +15,122 @@ import (
 	"time"
 )
 
+// A webhook delivery that was received by Octorunner (default view)
+//
+// Identifier: application/vnd.octorunner.delivery+json; view=default
+type OctorunnerDelivery struct {
+	// The raw body of the delivery
+	Body *string `form:"body,omitempty" json:"body,omitempty" xml:"body,omitempty"`
+	// The ID Github assigned to this delivery
+	DeliveryID string `form:"deliveryID" json:"deliveryID" xml:"deliveryID"`
+	// The event type of this delivery
+	Event string `form:"event" json:"event" xml:"event"`
+	// The headers the delivery was received with
+	Headers map[string][]string `form:"headers,omitempty" json:"headers,omitempty" xml:"headers,omitempty"`
+	// Unique delivery ID
+	ID int `form:"id" json:"id" xml:"id"`
+	// The job that was queued or skipped for this delivery
+	Job *int `form:"job,omitempty" json:"job,omitempty" xml:"job,omitempty"`
+	// What was done with the delivery
+	Outcome string `form:"outcome" json:"outcome" xml:"outcome"`
+	// The time the delivery was received
+	Received time.Time `form:"received" json:"received" xml:"received"`
+	// The result of verifying the delivery's signature
+	Signature string `form:"signature" json:"signature" xml:"signature"`
+}
+
+// Validate validates the OctorunnerDelivery media type instance.
+func (mt *OctorunnerDelivery) Validate() (err error) {
+
+	if mt.DeliveryID == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "deliveryID"))
+	}
+	if mt.Event == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "event"))
+	}
+	if mt.Signature == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "signature"))
+	}
+	if mt.Outcome == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "outcome"))
+	}
+
+	return
+}
+
+// A webhook delivery that was received by Octorunner (light view)
+//
+// Identifier: application/vnd.octorunner.delivery+json; view=light
+type OctorunnerDeliveryLight struct {
+	// The ID Github assigned to this delivery
+	DeliveryID string `form:"deliveryID" json:"deliveryID" xml:"deliveryID"`
+	// The event type of this delivery
+	Event string `form:"event" json:"event" xml:"event"`
+	// Unique delivery ID
+	ID int `form:"id" json:"id" xml:"id"`
+	// The job that was queued or skipped for this delivery
+	Job *int `form:"job,omitempty" json:"job,omitempty" xml:"job,omitempty"`
+	// What was done with the delivery
+	Outcome string `form:"outcome" json:"outcome" xml:"outcome"`
+	// The time the delivery was received
+	Received time.Time `form:"received" json:"received" xml:"received"`
+	// The result of verifying the delivery's signature
+	Signature string `form:"signature" json:"signature" xml:"signature"`
+}
+
+// Validate validates the OctorunnerDeliveryLight media type instance.
+func (mt *OctorunnerDeliveryLight) Validate() (err error) {
+
+	if mt.DeliveryID == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "deliveryID"))
+	}
+	if mt.Event == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "event"))
+	}
+	if mt.Signature == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "signature"))
+	}
+	if mt.Outcome == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "outcome"))
+	}
+
+	return
+}
+
+// OctorunnerDeliveryCollection is the media type for an array of OctorunnerDelivery (default view)
+//
+// Identifier: application/vnd.octorunner.delivery+json; type=collection; view=default
+type OctorunnerDeliveryCollection []*OctorunnerDelivery
+
+// Validate validates the OctorunnerDeliveryCollection media type instance.
+func (mt OctorunnerDeliveryCollection) Validate() (err error) {
+	for _, e := range mt {
+		if e != nil {
+			if err2 := e.Validate(); err2 != nil {
+				err = goa.MergeErrors(err, err2)
+			}
+		}
+	}
+	return
+}
+
+// OctorunnerDeliveryCollection is the media type for an array of OctorunnerDelivery (light view)
+//
+// Identifier: application/vnd.octorunner.delivery+json; type=collection; view=light
+type OctorunnerDeliveryLightCollection []*OctorunnerDeliveryLight
+
+// Validate validates the OctorunnerDeliveryLightCollection media type instance.
+func (mt OctorunnerDeliveryLightCollection) Validate() (err error) {
+	for _, e := range mt {
+		if e != nil {
+			if err2 := e.Validate(); err2 != nil {
+				err = goa.MergeErrors(err, err2)
+			}
+		}
+	}
+	return
+}
+
 // A job that was ran after a commit on a project (default view)
 //
 // Identifier: application/vnd.octorunner.job+json; view=default
@@ -32,6 +148,16 @@ type OctorunnerJob struct {
 	Job string `form:"job" json:"job" xml:"job"`
 	// The project this job belongs to
 	Project int `form:"project" json:"project" xml:"project"`
+	// The provider hosting the repository this job was ran for
+	Provider *string `form:"provider,omitempty" json:"provider,omitempty" xml:"provider,omitempty"`
+	// The number of the pull request this job was ran for
+	PullRequest *int `form:"pullRequest,omitempty" json:"pullRequest,omitempty" xml:"pullRequest,omitempty"`
+	// The position of this job in the queue, only set while the job is queued
+	QueuePosition *int `form:"queuePosition,omitempty" json:"queuePosition,omitempty" xml:"queuePosition,omitempty"`
+	// The git ref this job was ran for
+	Ref *string `form:"ref,omitempty" json:"ref,omitempty" xml:"ref,omitempty"`
+	// Whether this job was queued by a schedule, only set for scheduled jobs
+	Scheduled *bool `form:"scheduled,omitempty" json:"scheduled,omitempty" xml:"scheduled,omitempty"`
 	// The status of the job
 	Status string `form:"status" json:"status" xml:"status"`
 }
@@ -52,8 +178,8 @@ func (mt *OctorunnerJob) Validate() (err error) {
 	if mt.Extra == "" {
 		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "extra"))
 	}
-	if !(mt.Status == "running" || mt.Status == "done" || mt.Status == "error") {
-		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.status`, mt.Status, []interface{}{"running", "done", "error"}))
+	if !(mt.Status == "queued" || mt.Status == "running" || mt.Status == "done" || mt.Status == "error" || mt.Status == "skipped" || mt.Status == "cancelled") {
+		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.status`, mt.Status, []interface{}{"queued", "running", "done", "error", "skipped", "cancelled"}))
 	}
 	return
 }
@@ -74,6 +200,16 @@ type OctorunnerJobLight struct {
 	Job string `form:"job" json:"job" xml:"job"`
 	// The project this job belongs to
 	Project int `form:"project" json:"project" xml:"project"`
+	// The provider hosting the repository this job was ran for
+	Provider *string `form:"provider,omitempty" json:"provider,omitempty" xml:"provider,omitempty"`
+	// The number of the pull request this job was ran for
+	PullRequest *int `form:"pullRequest,omitempty" json:"pullRequest,omitempty" xml:"pullRequest,omitempty"`
+	// The position of this job in the queue, only set while the job is queued
+	QueuePosition *int `form:"queuePosition,omitempty" json:"queuePosition,omitempty" xml:"queuePosition,omitempty"`
+	// The git ref this job was ran for
+	Ref *string `form:"ref,omitempty" json:"ref,omitempty" xml:"ref,omitempty"`
+	// Whether this job was queued by a schedule, only set for scheduled jobs
+	Scheduled *bool `form:"scheduled,omitempty" json:"scheduled,omitempty" xml:"scheduled,omitempty"`
 	// The status of the job
 	Status string `form:"status" json:"status" xml:"status"`
 }
@@ -94,8 +230,8 @@ func (mt *OctorunnerJobLight) Validate() (err error) {
 	if mt.Extra == "" {
 		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "extra"))
 	}
-	if !(mt.Status == "running" || mt.Status == "done" || mt.Status == "error") {
-		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.status`, mt.Status, []interface{}{"running", "done", "error"}))
+	if !(mt.Status == "queued" || mt.Status == "running" || mt.Status == "done" || mt.Status == "error" || mt.Status == "skipped" || mt.Status == "cancelled") {
+		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.status`, mt.Status, []interface{}{"queued", "running", "done", "error", "skipped", "cancelled"}))
 	}
 	return
 }
@@ -22,13 +22,336 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 )
 
+// BuildProjectAccepted runs the method Build of the given controller with the given parameters and payload.
+// It returns the response writer so it's possible to inspect the response headers and the media type struct written to the response.
+// If ctx is nil then context.Background() is used.
+// If service is nil then a default service is created.
+func BuildProjectAccepted(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, payload *app.BuildPayload) (http.ResponseWriter, app.OctorunnerJobCollection) {
+	// Setup service
+	var (
+		logBuf bytes.Buffer
+		resp   interface{}
+
+		respSetter goatest.ResponseSetterFunc = func(r interface{}) { resp = r }
+	)
+	if service == nil {
+		service = goatest.Service(&logBuf, respSetter)
+	} else {
+		logger := log.New(&logBuf, "", log.Ltime)
+		service.WithLogger(goa.NewLogger(logger))
+		newEncoder := func(io.Writer) goa.Encoder { return respSetter }
+		service.Encoder = goa.NewHTTPEncoder() // Make sure the code ends up using this decoder
+		service.Encoder.Register(newEncoder, "*/*")
+	}
+
+	// Setup request context
+	rw := httptest.NewRecorder()
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/projects/%v/builds", projectID),
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		panic("invalid test " + err.Error()) // bug
+	}
+	prms := url.Values{}
+	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	goaCtx := goa.NewContext(goa.WithAction(ctx, "ProjectTest"), rw, req, prms)
+	buildCtx, _err := app.NewBuildProjectContext(goaCtx, req, service)
+	if _err != nil {
+		panic("invalid test data " + _err.Error()) // bug
+	}
+	buildCtx.Payload = payload
+
+	// Perform action
+	_err = ctrl.Build(buildCtx)
+
+	// Validate response
+	if _err != nil {
+		t.Fatalf("controller returned %+v, logs:\n%s", _err, logBuf.String())
+	}
+	if rw.Code != 202 {
+		t.Errorf("invalid response status code: got %+v, expected 202", rw.Code)
+	}
+	var mt app.OctorunnerJobCollection
+	if resp != nil {
+		var ok bool
+		mt, ok = resp.(app.OctorunnerJobCollection)
+		if !ok {
+			t.Fatalf("invalid response media: got %+v, expected instance of app.OctorunnerJobCollection", resp)
+		}
+		_err = mt.Validate()
+		if _err != nil {
+			t.Errorf("invalid response media type: %s", _err)
+		}
+	}
+
+	// Return results
+	return rw, mt
+}
+
+// BuildProjectAcceptedLight runs the method Build of the given controller with the given parameters and payload.
+// It returns the response writer so it's possible to inspect the response headers and the media type struct written to the response.
+// If ctx is nil then context.Background() is used.
+// If service is nil then a default service is created.
+func BuildProjectAcceptedLight(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, payload *app.BuildPayload) (http.ResponseWriter, app.OctorunnerJobLightCollection) {
+	// Setup service
+	var (
+		logBuf bytes.Buffer
+		resp   interface{}
+
+		respSetter goatest.ResponseSetterFunc = func(r interface{}) { resp = r }
+	)
+	if service == nil {
+		service = goatest.Service(&logBuf, respSetter)
+	} else {
+		logger := log.New(&logBuf, "", log.Ltime)
+		service.WithLogger(goa.NewLogger(logger))
+		newEncoder := func(io.Writer) goa.Encoder { return respSetter }
+		service.Encoder = goa.NewHTTPEncoder() // Make sure the code ends up using this decoder
+		service.Encoder.Register(newEncoder, "*/*")
+	}
+
+	// Setup request context
+	rw := httptest.NewRecorder()
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/projects/%v/builds", projectID),
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		panic("invalid test " + err.Error()) // bug
+	}
+	prms := url.Values{}
+	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	goaCtx := goa.NewContext(goa.WithAction(ctx, "ProjectTest"), rw, req, prms)
+	buildCtx, _err := app.NewBuildProjectContext(goaCtx, req, service)
+	if _err != nil {
+		panic("invalid test data " + _err.Error()) // bug
+	}
+	buildCtx.Payload = payload
+
+	// Perform action
+	_err = ctrl.Build(buildCtx)
+
+	// Validate response
+	if _err != nil {
+		t.Fatalf("controller returned %+v, logs:\n%s", _err, logBuf.String())
+	}
+	if rw.Code != 202 {
+		t.Errorf("invalid response status code: got %+v, expected 202", rw.Code)
+	}
+	var mt app.OctorunnerJobLightCollection
+	if resp != nil {
+		var ok bool
+		mt, ok = resp.(app.OctorunnerJobLightCollection)
+		if !ok {
+			t.Fatalf("invalid response media: got %+v, expected instance of app.OctorunnerJobLightCollection", resp)
+		}
+		_err = mt.Validate()
+		if _err != nil {
+			t.Errorf("invalid response media type: %s", _err)
+		}
+	}
+
+	// Return results
+	return rw, mt
+}
+
+// BuildProjectBadRequest runs the method Build of the given controller with the given parameters and payload.
+// It returns the response writer so it's possible to inspect the response headers and the media type struct written to the response.
+// If ctx is nil then context.Background() is used.
+// If service is nil then a default service is created.
+func BuildProjectBadRequest(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, payload *app.BuildPayload) (http.ResponseWriter, error) {
+	// Setup service
+	var (
+		logBuf bytes.Buffer
+		resp   interface{}
+
+		respSetter goatest.ResponseSetterFunc = func(r interface{}) { resp = r }
+	)
+	if service == nil {
+		service = goatest.Service(&logBuf, respSetter)
+	} else {
+		logger := log.New(&logBuf, "", log.Ltime)
+		service.WithLogger(goa.NewLogger(logger))
+		newEncoder := func(io.Writer) goa.Encoder { return respSetter }
+		service.Encoder = goa.NewHTTPEncoder() // Make sure the code ends up using this decoder
+		service.Encoder.Register(newEncoder, "*/*")
+	}
+
+	// Setup request context
+	rw := httptest.NewRecorder()
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/projects/%v/builds", projectID),
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		panic("invalid test " + err.Error()) // bug
+	}
+	prms := url.Values{}
+	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	goaCtx := goa.NewContext(goa.WithAction(ctx, "ProjectTest"), rw, req, prms)
+	buildCtx, _err := app.NewBuildProjectContext(goaCtx, req, service)
+	if _err != nil {
+		panic("invalid test data " + _err.Error()) // bug
+	}
+	buildCtx.Payload = payload
+
+	// Perform action
+	_err = ctrl.Build(buildCtx)
+
+	// Validate response
+	if _err != nil {
+		t.Fatalf("controller returned %+v, logs:\n%s", _err, logBuf.String())
+	}
+	if rw.Code != 400 {
+		t.Errorf("invalid response status code: got %+v, expected 400", rw.Code)
+	}
+	var mt error
+	if resp != nil {
+		var ok bool
+		mt, ok = resp.(error)
+		if !ok {
+			t.Fatalf("invalid response media: got %+v, expected instance of error", resp)
+		}
+	}
+
+	// Return results
+	return rw, mt
+}
+
+// BuildProjectNotFound runs the method Build of the given controller with the given parameters and payload.
+// It returns the response writer so it's possible to inspect the response headers.
+// If ctx is nil then context.Background() is used.
+// If service is nil then a default service is created.
+func BuildProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, payload *app.BuildPayload) http.ResponseWriter {
+	// Setup service
+	var (
+		logBuf bytes.Buffer
+		resp   interface{}
+
+		respSetter goatest.ResponseSetterFunc = func(r interface{}) { resp = r }
+	)
+	if service == nil {
+		service = goatest.Service(&logBuf, respSetter)
+	} else {
+		logger := log.New(&logBuf, "", log.Ltime)
+		service.WithLogger(goa.NewLogger(logger))
+		newEncoder := func(io.Writer) goa.Encoder { return respSetter }
+		service.Encoder = goa.NewHTTPEncoder() // Make sure the code ends up using this decoder
+		service.Encoder.Register(newEncoder, "*/*")
+	}
+
+	// Setup request context
+	rw := httptest.NewRecorder()
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/projects/%v/builds", projectID),
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		panic("invalid test " + err.Error()) // bug
+	}
+	prms := url.Values{}
+	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	goaCtx := goa.NewContext(goa.WithAction(ctx, "ProjectTest"), rw, req, prms)
+	buildCtx, _err := app.NewBuildProjectContext(goaCtx, req, service)
+	if _err != nil {
+		panic("invalid test data " + _err.Error()) // bug
+	}
+	buildCtx.Payload = payload
+
+	// Perform action
+	_err = ctrl.Build(buildCtx)
+
+	// Validate response
+	if _err != nil {
+		t.Fatalf("controller returned %+v, logs:\n%s", _err, logBuf.String())
+	}
+	if rw.Code != 404 {
+		t.Errorf("invalid response status code: got %+v, expected 404", rw.Code)
+	}
+
+	// Return results
+	return rw
+}
+
+// BuildProjectServiceUnavailable runs the method Build of the given controller with the given parameters and payload.
+// It returns the response writer so it's possible to inspect the response headers.
+// If ctx is nil then context.Background() is used.
+// If service is nil then a default service is created.
+func BuildProjectServiceUnavailable(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, payload *app.BuildPayload) http.ResponseWriter {
+	// Setup service
+	var (
+		logBuf bytes.Buffer
+		resp   interface{}
+
+		respSetter goatest.ResponseSetterFunc = func(r interface{}) { resp = r }
+	)
+	if service == nil {
+		service = goatest.Service(&logBuf, respSetter)
+	} else {
+		logger := log.New(&logBuf, "", log.Ltime)
+		service.WithLogger(goa.NewLogger(logger))
+		newEncoder := func(io.Writer) goa.Encoder { return respSetter }
+		service.Encoder = goa.NewHTTPEncoder() // Make sure the code ends up using this decoder
+		service.Encoder.Register(newEncoder, "*/*")
+	}
+
+	// Setup request context
+	rw := httptest.NewRecorder()
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/projects/%v/builds", projectID),
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		panic("invalid test " + err.Error()) // bug
+	}
+	prms := url.Values{}
+	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	goaCtx := goa.NewContext(goa.WithAction(ctx, "ProjectTest"), rw, req, prms)
+	buildCtx, _err := app.NewBuildProjectContext(goaCtx, req, service)
+	if _err != nil {
+		panic("invalid test data " + _err.Error()) // bug
+	}
+	buildCtx.Payload = payload
+
+	// Perform action
+	_err = ctrl.Build(buildCtx)
+
+	// Validate response
+	if _err != nil {
+		t.Fatalf("controller returned %+v, logs:\n%s", _err, logBuf.String())
+	}
+	if rw.Code != 503 {
+		t.Errorf("invalid response status code: got %+v, expected 503", rw.Code)
+	}
+
+	// Return results
+	return rw
+}
+
 // JobsProjectNotFound runs the method Jobs of the given controller with the given parameters.
 // It returns the response writer so it's possible to inspect the response headers.
 // If ctx is nil then context.Background() is used.
 // If service is nil then a default service is created.
-func JobsProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int) http.ResponseWriter {
+func JobsProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, pullRequest *int) http.ResponseWriter {
 	// Setup service
 	var (
 		logBuf bytes.Buffer
@@ -48,8 +371,14 @@ func JobsProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa
 
 	// Setup request context
 	rw := httptest.NewRecorder()
+	query := url.Values{}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		query["pullRequest"] = sliceVal
+	}
 	u := &url.URL{
-		Path: fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		Path:     fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		RawQuery: query.Encode(),
 	}
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -57,6 +386,10 @@ func JobsProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa
 	}
 	prms := url.Values{}
 	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		prms["pullRequest"] = sliceVal
+	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -85,7 +418,7 @@ func JobsProjectNotFound(t goatest.TInterface, ctx context.Context, service *goa
 // It returns the response writer so it's possible to inspect the response headers and the media type struct written to the response.
 // If ctx is nil then context.Background() is used.
 // If service is nil then a default service is created.
-func JobsProjectOK(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int) (http.ResponseWriter, app.OctorunnerJobCollection) {
+func JobsProjectOK(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, pullRequest *int) (http.ResponseWriter, app.OctorunnerJobCollection) {
 	// Setup service
 	var (
 		logBuf bytes.Buffer
@@ -105,8 +438,14 @@ func JobsProjectOK(t goatest.TInterface, ctx context.Context, service *goa.Servi
 
 	// Setup request context
 	rw := httptest.NewRecorder()
+	query := url.Values{}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		query["pullRequest"] = sliceVal
+	}
 	u := &url.URL{
-		Path: fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		Path:     fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		RawQuery: query.Encode(),
 	}
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -114,6 +453,10 @@ func JobsProjectOK(t goatest.TInterface, ctx context.Context, service *goa.Servi
 	}
 	prms := url.Values{}
 	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		prms["pullRequest"] = sliceVal
+	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -154,7 +497,7 @@ func JobsProjectOK(t goatest.TInterface, ctx context.Context, service *goa.Servi
 // It returns the response writer so it's possible to inspect the response headers and the media type struct written to the response.
 // If ctx is nil then context.Background() is used.
 // If service is nil then a default service is created.
-func JobsProjectOKLight(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int) (http.ResponseWriter, app.OctorunnerJobLightCollection) {
+func JobsProjectOKLight(t goatest.TInterface, ctx context.Context, service *goa.Service, ctrl app.ProjectController, projectID int, pullRequest *int) (http.ResponseWriter, app.OctorunnerJobLightCollection) {
 	// Setup service
 	var (
 		logBuf bytes.Buffer
@@ -174,8 +517,14 @@ func JobsProjectOKLight(t goatest.TInterface, ctx context.Context, service *goa.
 
 	// Setup request context
 	rw := httptest.NewRecorder()
+	query := url.Values{}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		query["pullRequest"] = sliceVal
+	}
 	u := &url.URL{
-		Path: fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		Path:     fmt.Sprintf("/api/projects/%v/jobs", projectID),
+		RawQuery: query.Encode(),
 	}
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -183,6 +532,10 @@ func JobsProjectOKLight(t goatest.TInterface, ctx context.Context, service *goa.
 	}
 	prms := url.Values{}
 	prms["projectID"] = []string{fmt.Sprintf("%v", projectID)}
+	if pullRequest != nil {
+		sliceVal := []string{strconv.Itoa(*pullRequest)}
+		prms["pullRequest"] = sliceVal
+	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -9,3 +9,38 @@
 // The content of this file is auto-generated, DO NOT MODIFY
 
 package app
+
+// The commit to build, given by its ID or by the ref pointing to it
+type buildPayload struct {
+	// The commit to build, takes precedence over the ref
+	CommitID *string `form:"commitID,omitempty" json:"commitID,omitempty" xml:"commitID,omitempty"`
+	// The ref to build, refs that don't start with refs/ are taken to be branches
+	Ref *string `form:"ref,omitempty" json:"ref,omitempty" xml:"ref,omitempty"`
+	// Environment variables that are passed to the job, their names may only contain letters, digits and underscores
+	Variables map[string]string `form:"variables,omitempty" json:"variables,omitempty" xml:"variables,omitempty"`
+}
+
+// Publicize creates BuildPayload from buildPayload
+func (ut *buildPayload) Publicize() *BuildPayload {
+	var pub BuildPayload
+	if ut.CommitID != nil {
+		pub.CommitID = ut.CommitID
+	}
+	if ut.Ref != nil {
+		pub.Ref = ut.Ref
+	}
+	if ut.Variables != nil {
+		pub.Variables = ut.Variables
+	}
+	return &pub
+}
+
+// The commit to build, given by its ID or by the ref pointing to it
+type BuildPayload struct {
+	// The commit to build, takes precedence over the ref
+	CommitID *string `form:"commitID,omitempty" json:"commitID,omitempty" xml:"commitID,omitempty"`
+	// The ref to build, refs that don't start with refs/ are taken to be branches
+	Ref *string `form:"ref,omitempty" json:"ref,omitempty" xml:"ref,omitempty"`
+	// Environment variables that are passed to the job, their names may only contain letters, digits and underscores
+	Variables map[string]string `form:"variables,omitempty" json:"variables,omitempty" xml:"variables,omitempty"`
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"github.com/boyvanduuren/octorunner/lib/git"
+	"github.com/boyvanduuren/octorunner/lib/persist"
+	"github.com/boyvanduuren/octorunner/lib/webapi/app"
+	"github.com/goadesign/goa"
+	"github.com/goadesign/goa/logging/logrus"
+)
+
+// DeliveryController implements the delivery resource.
+type DeliveryController struct {
+	*goa.Controller
+}
+
+// NewDeliveryController creates a delivery controller.
+func NewDeliveryController(service *goa.Service) *DeliveryController {
+	return &DeliveryController{Controller: service.NewController("DeliveryController")}
+}
+
+func ToDeliveryMedia(delivery *persist.Delivery) *app.OctorunnerDelivery {
+	res := &app.OctorunnerDelivery{
+		ID:         int(delivery.ID),
+		DeliveryID: delivery.DeliveryID,
+		Event:      delivery.Event,
+		Headers:    delivery.Headers,
+		Body:       &delivery.Body,
+		Signature:  delivery.Signature,
+		Outcome:    delivery.Outcome,
+		Received:   delivery.Received,
+	}
+	if delivery.Job != 0 {
+		job := int(delivery.Job)
+		res.Job = &job
+	}
+
+	return res
+}
+
+// List runs the list action.
+func (c *DeliveryController) List(ctx *app.ListDeliveryContext) error {
+	// DeliveryController_List: start_implement
+
+	// Put your logic here
+	deliveries, err := persist.DBConn.FindDeliveries()
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying deliveries: %v", err)
+		return err
+	}
+
+	deliveryCollection := make(app.OctorunnerDeliveryLightCollection, len(deliveries))
+	for i, delivery := range deliveries {
+		deliveryCollection[i] = &app.OctorunnerDeliveryLight{
+			ID:         int(delivery.ID),
+			DeliveryID: delivery.DeliveryID,
+			Event:      delivery.Event,
+			Signature:  delivery.Signature,
+			Outcome:    delivery.Outcome,
+			Received:   delivery.Received,
+		}
+		if delivery.Job != 0 {
+			job := int(delivery.Job)
+			deliveryCollection[i].Job = &job
+		}
+	}
+
+	return ctx.OKLight(deliveryCollection)
+	// DeliveryController_List: end_implement
+}
+
+// Replay runs the replay action.
+func (c *DeliveryController) Replay(ctx *app.ReplayDeliveryContext) error {
+	// DeliveryController_Replay: start_implement
+
+	// Put your logic here
+	res, err := git.ReplayDelivery(int64(ctx.DeliveryID), ctx.Force)
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While replaying delivery %d: %v", ctx.DeliveryID, err)
+		return ctx.NotFound()
+	}
+
+	return ctx.OK(ToDeliveryMedia(res))
+	// DeliveryController_Replay: end_implement
+}
+
+// Show runs the show action.
+func (c *DeliveryController) Show(ctx *app.ShowDeliveryContext) error {
+	// DeliveryController_Show: start_implement
+
+	// Put your logic here
+	res, err := persist.DBConn.FindDelivery(int64(ctx.DeliveryID))
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying delivery %d: %v", ctx.DeliveryID, err)
+		return ctx.NotFound()
+	}
+
+	return ctx.OK(ToDeliveryMedia(res))
+	// DeliveryController_Show: end_implement
+}
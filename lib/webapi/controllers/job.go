@@ -3,10 +3,14 @@ package controllers
 import (
 	"github.com/boyvanduuren/octorunner/lib/webapi/app"
 	"github.com/goadesign/goa"
+	"github.com/boyvanduuren/octorunner/lib/git"
 	"github.com/boyvanduuren/octorunner/lib/persist"
 	"github.com/goadesign/goa/logging/logrus"
 )
 
+// Errors for requests that conflict with the state of a job, e.g. retrying a job that's still running.
+var errConflict = goa.NewErrorClass("conflict", 409)
+
 // JobController implements the job resource.
 type JobController struct {
 	*goa.Controller
@@ -29,7 +33,7 @@ func ToProjectMedia(job *persist.Job) (*app.OctorunnerJob) {
 		}
 	}
 
-	return &app.OctorunnerJob{
+	res := &app.OctorunnerJob{
 		ID: int(job.ID),
 		Iteration: int(job.Iteration),
 		CommitID: job.CommitID,
@@ -40,6 +44,62 @@ func ToProjectMedia(job *persist.Job) (*app.OctorunnerJob) {
 		Data: dataCollection,
 
 	}
+	if job.PullRequest != 0 {
+		pullRequest := int(job.PullRequest)
+		res.PullRequest = &pullRequest
+	}
+	if job.Ref != "" {
+		ref := job.Ref
+		res.Ref = &ref
+	}
+	if job.Provider != "" {
+		provider := job.Provider
+		res.Provider = &provider
+	}
+	if job.Scheduled {
+		scheduled := true
+		res.Scheduled = &scheduled
+	}
+	if job.QueuePosition != 0 {
+		queuePosition := int(job.QueuePosition)
+		res.QueuePosition = &queuePosition
+	}
+
+	return res
+}
+
+func ToLightMedia(job *persist.Job) (*app.OctorunnerJobLight) {
+	res := &app.OctorunnerJobLight{
+		ID: int(job.ID),
+		Iteration: int(job.Iteration),
+		CommitID: job.CommitID,
+		Project: int(job.Project),
+		Job: job.Job,
+		Status: job.Status,
+		Extra: job.Extra,
+	}
+	if job.PullRequest != 0 {
+		pullRequest := int(job.PullRequest)
+		res.PullRequest = &pullRequest
+	}
+	if job.Ref != "" {
+		ref := job.Ref
+		res.Ref = &ref
+	}
+	if job.Provider != "" {
+		provider := job.Provider
+		res.Provider = &provider
+	}
+	if job.Scheduled {
+		scheduled := true
+		res.Scheduled = &scheduled
+	}
+	if job.QueuePosition != 0 {
+		queuePosition := int(job.QueuePosition)
+		res.QueuePosition = &queuePosition
+	}
+
+	return res
 }
 
 // Show runs the show action.
@@ -76,3 +136,90 @@ func (c *JobController) ShowLatest(ctx *app.ShowLatestJobContext) error {
 	return ctx.OK(ToProjectMedia(res))
 	// JobController_ShowLatest: end_implement
 }
+
+// Queue runs the queue action.
+func (c *JobController) Queue(ctx *app.QueueJobContext) error {
+	// JobController_Queue: start_implement
+
+	// Put your logic here
+	jobs, err := persist.DBConn.FindQueuedJobs()
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying queued jobs: %q", err)
+		return err
+	}
+
+	jobCollection := make(app.OctorunnerJobLightCollection, len(jobs))
+	for i, job := range jobs {
+		jobCollection[i] = ToLightMedia(&job)
+	}
+
+	return ctx.OKLight(jobCollection)
+	// JobController_Queue: end_implement
+}
+
+// Retry runs the retry action.
+func (c *JobController) Retry(ctx *app.RetryJobContext) error {
+	// JobController_Retry: start_implement
+
+	// Put your logic here
+	job, err := persist.DBConn.FindJob(int64(ctx.JobID))
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying job %d: %v", ctx.JobID, err)
+		return ctx.NotFound()
+	}
+
+	jobID, err := git.RetryJob(*job)
+	switch {
+	case err == git.ErrJobActive:
+		return ctx.Conflict(errConflict(err))
+	case err == git.ErrQueueFull:
+		return ctx.ServiceUnavailable()
+	case err != nil:
+		goalogrus.Entry(ctx).Errorf("While retrying job %d: %v", ctx.JobID, err)
+		return err
+	}
+
+	res, err := persist.DBConn.FindJob(jobID)
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying job %d: %v", jobID, err)
+		return err
+	}
+
+	return ctx.AcceptedLight(ToLightMedia(res))
+	// JobController_Retry: end_implement
+}
+
+// Cancel runs the cancel action.
+func (c *JobController) Cancel(ctx *app.CancelJobContext) error {
+	// JobController_Cancel: start_implement
+
+	// Put your logic here
+	job, err := persist.DBConn.FindJob(int64(ctx.JobID))
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying job %d: %v", ctx.JobID, err)
+		return ctx.NotFound()
+	}
+
+	var by string
+	if ctx.By != nil {
+		by = *ctx.By
+	}
+	err = git.CancelJob(*job, by)
+	switch {
+	case err == git.ErrJobNotActive:
+		return ctx.Conflict(errConflict(err))
+	case err != nil:
+		goalogrus.Entry(ctx).Errorf("While cancelling job %d: %v", ctx.JobID, err)
+		return err
+	}
+
+	// Running jobs are still being stopped, so their status might not be "cancelled" yet
+	res, err := persist.DBConn.FindJob(job.ID)
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying job %d: %v", job.ID, err)
+		return err
+	}
+
+	return ctx.AcceptedLight(ToLightMedia(res))
+	// JobController_Cancel: end_implement
+}
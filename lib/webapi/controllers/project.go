@@ -3,6 +3,7 @@ package controllers
 import (
 	"github.com/boyvanduuren/octorunner/lib/webapi/app"
 	"github.com/goadesign/goa"
+	"github.com/boyvanduuren/octorunner/lib/git"
 	"github.com/boyvanduuren/octorunner/lib/persist"
 	"github.com/goadesign/goa/logging/logrus"
 )
@@ -17,12 +18,62 @@ func NewProjectController(service *goa.Service) *ProjectController {
 	return &ProjectController{Controller: service.NewController("ProjectController")}
 }
 
+// Build runs the build action.
+func (c *ProjectController) Build(ctx *app.BuildProjectContext) error {
+	// ProjectController_Build: start_implement
+
+	// Put your logic here
+	project, err := persist.DBConn.FindProjectByID(int64(ctx.ProjectID))
+	if err != nil {
+		goalogrus.Entry(ctx).Errorf("While querying project %d: %v", ctx.ProjectID, err)
+		return ctx.NotFound()
+	}
+
+	var ref, commitID string
+	if ctx.Payload.Ref != nil {
+		ref = *ctx.Payload.Ref
+	}
+	if ctx.Payload.CommitID != nil {
+		commitID = *ctx.Payload.CommitID
+	}
+	jobIDs, err := git.TriggerBuild(*project, ref, commitID, ctx.Payload.Variables)
+	_, invalidVariable := err.(git.InvalidVariableError)
+	switch {
+	case err == git.ErrMissingRef || invalidVariable:
+		return ctx.BadRequest(goa.ErrBadRequest(err))
+	case err == git.ErrQueueFull:
+		return ctx.ServiceUnavailable()
+	case err != nil:
+		goalogrus.Entry(ctx).Errorf("While triggering build of project %d: %v", ctx.ProjectID, err)
+		return err
+	}
+
+	jobCollection := make(app.OctorunnerJobLightCollection, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		job, err := persist.DBConn.FindJob(jobID)
+		if err != nil {
+			goalogrus.Entry(ctx).Errorf("While querying job %d: %v", jobID, err)
+			return err
+		}
+		jobCollection = append(jobCollection, ToLightMedia(job))
+	}
+
+	return ctx.AcceptedLight(jobCollection)
+	// ProjectController_Build: end_implement
+}
+
 // Jobs runs the jobs action.
 func (c *ProjectController) Jobs(ctx *app.JobsProjectContext) error {
 	// ProjectController_Jobs: start_implement
 
 	// Put your logic here
-	jobs, err := persist.DBConn.FindJobsForProject(int64(ctx.ProjectID))
+	var jobs []persist.Job
+	var err error
+	if ctx.PullRequest != nil {
+		jobs, err = persist.DBConn.FindJobsForPullRequest(int64(ctx.ProjectID), int64(*ctx.PullRequest))
+	} else {
+		jobs, err = persist.DBConn.FindJobsForProject(int64(ctx.ProjectID))
+	}
 	if err != nil {
 		goalogrus.Entry(ctx).Errorf("While finding jobs for project %q: %q", ctx.ProjectID, err)
 		return ctx.NotFound()
@@ -30,15 +81,7 @@ func (c *ProjectController) Jobs(ctx *app.JobsProjectContext) error {
 
 	jobCollection := make(app.OctorunnerJobLightCollection, len(jobs))
 	for i, job := range jobs {
-		jobCollection[i] = &app.OctorunnerJobLight{
-			ID: int(job.ID),
-			Iteration: int(job.Iteration),
-			CommitID: job.CommitID,
-			Project: int(job.Project),
-			Job: job.Job,
-			Status: job.Status,
-			Extra: job.Extra,
-		}
+		jobCollection[i] = ToLightMedia(&job)
 	}
 
 	return ctx.OKLight(jobCollection)
@@ -50,11 +50,26 @@ var Job = MediaType("application/vnd.octorunner.job+json", func() {
 		})
 		Attribute("status", String, "The status of the job", func() {
 			Example("running")
-			Enum("running", "done", "error")
+			Enum("queued", "running", "done", "error", "skipped", "cancelled")
 		})
 		Attribute("extra", String, "Extra information, this might contain error information", func() {
 			Example("Some error message")
 		})
+		Attribute("pullRequest", Integer, "The number of the pull request this job was ran for", func() {
+			Example(12)
+		})
+		Attribute("ref", String, "The git ref this job was ran for", func() {
+			Example("refs/tags/v1.2.0")
+		})
+		Attribute("provider", String, "The provider hosting the repository this job was ran for", func() {
+			Example("github")
+		})
+		Attribute("scheduled", Boolean, "Whether this job was queued by a schedule, only set for scheduled jobs", func() {
+			Example(true)
+		})
+		Attribute("queuePosition", Integer, "The position of this job in the queue, only set while the job is queued", func() {
+			Example(3)
+		})
 		Attribute("data", ArrayOf(Output))
 		Required("id", "project", "commitID", "job", "iteration", "status", "extra")
 	})
@@ -66,6 +81,11 @@ var Job = MediaType("application/vnd.octorunner.job+json", func() {
 		Attribute("job")
 		Attribute("status")
 		Attribute("extra")
+		Attribute("pullRequest")
+		Attribute("ref")
+		Attribute("provider")
+		Attribute("scheduled")
+		Attribute("queuePosition")
 		Attribute("data")
 	})
 	View("light", func() {
@@ -76,6 +96,11 @@ var Job = MediaType("application/vnd.octorunner.job+json", func() {
 		Attribute("job")
 		Attribute("status")
 		Attribute("extra")
+		Attribute("pullRequest")
+		Attribute("ref")
+		Attribute("provider")
+		Attribute("scheduled")
+		Attribute("queuePosition")
 	})
 })
 
@@ -97,3 +122,67 @@ var Output = MediaType("application/vnd.octorunner.output+json", func() {
 		Attribute("timestamp")
 	})
 })
+
+// Deliveries are the webhook deliveries octorunner received, together with what was done with them.
+var Delivery = MediaType("application/vnd.octorunner.delivery+json", func() {
+	Description("A webhook delivery that was received by Octorunner")
+	Attributes(func() {
+		Attribute("id", Integer, "Unique delivery ID", func() {
+			Example(1)
+		})
+		Attribute("deliveryID", String, "The ID Github assigned to this delivery", func() {
+			Example("72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		})
+		Attribute("event", String, "The event type of this delivery", func() {
+			Example("push")
+		})
+		Attribute("headers", HashOf(String, ArrayOf(String)), "The headers the delivery was received with")
+		Attribute("body", String, "The raw body of the delivery")
+		Attribute("signature", String, "The result of verifying the delivery's signature", func() {
+			Example("valid")
+		})
+		Attribute("outcome", String, "What was done with the delivery", func() {
+			Example("Queued job 5")
+		})
+		Attribute("job", Integer, "The job that was queued or skipped for this delivery", func() {
+			Example(5)
+		})
+		Attribute("received", DateTime, "The time the delivery was received")
+		Required("id", "deliveryID", "event", "signature", "outcome", "received")
+	})
+	View("default", func() {
+		Attribute("id")
+		Attribute("deliveryID")
+		Attribute("event")
+		Attribute("headers")
+		Attribute("body")
+		Attribute("signature")
+		Attribute("outcome")
+		Attribute("job")
+		Attribute("received")
+	})
+	View("light", func() {
+		Attribute("id")
+		Attribute("deliveryID")
+		Attribute("event")
+		Attribute("signature")
+		Attribute("outcome")
+		Attribute("job")
+		Attribute("received")
+	})
+})
+
+// The payload used to trigger a build.
+var BuildPayload = Type("BuildPayload", func() {
+	Description("The commit to build, given by its ID or by the ref pointing to it")
+	Attribute("ref", String, "The ref to build, refs that don't start with refs/ are taken to be branches", func() {
+		Example("refs/heads/master")
+	})
+	Attribute("commitID", String, "The commit to build, takes precedence over the ref", func() {
+		Example("093a16cb43d696d32ae73a529c6165b80c1ce844")
+	})
+	Attribute("variables", HashOf(String, String), "Environment variables that are passed to the job, their names "+
+		"may only contain letters, digits and underscores", func() {
+		Example(map[string]string{"DEPLOY": "true"})
+	})
+})
@@ -30,6 +30,7 @@ var _ = Resource("project", func() {
 		Routing(GET("/:projectID/jobs"))
 		Params(func() {
 			Param("projectID", Integer, "Project ID")
+			Param("pullRequest", Integer, "Only return jobs that ran for this pull request")
 		})
 		// We don't want to eagerly fetch all data of every job, so we return
 		// a collection of the light Job view.
@@ -39,6 +40,21 @@ var _ = Resource("project", func() {
 		Response(NotFound)
 	})
 
+	Action("build", func() {
+		Description("Trigger a build of a commit of a project, returns the jobs that were queued for it")
+		Routing(POST("/:projectID/builds"))
+		Params(func() {
+			Param("projectID", Integer, "Project ID")
+		})
+		Payload(BuildPayload)
+		Response(Accepted, func() {
+			Media(CollectionOf(Job), "light")
+		})
+		Response(BadRequest, ErrorMedia)
+		Response(NotFound)
+		Response(ServiceUnavailable)
+	})
+
 })
 
 var _ = Resource("job", func() {
@@ -61,4 +77,76 @@ var _ = Resource("job", func() {
 		Response(OK)
 		Response(NotFound)
 	})
+
+	Action("queue", func() {
+		Description("Get all queued jobs, in the order in which they will be executed")
+		Routing(GET("/queue"))
+		Response(OK, func() {
+			Media(CollectionOf(Job), "light")
+		})
+	})
+
+	Action("retry", func() {
+		Description("Run the commit and job name of a job again as its next iteration, returns the new job")
+		Routing(POST("/:jobID/retry"))
+		Params(func() {
+			Param("jobID", Integer, "Job ID")
+		})
+		Response(Accepted, func() {
+			Media(Job, "light")
+		})
+		Response(NotFound)
+		Response(Conflict, ErrorMedia)
+		Response(ServiceUnavailable)
+	})
+
+	Action("cancel", func() {
+		Description("Cancel a queued or running job, running jobs have their container stopped and removed")
+		Routing(POST("/:jobID/cancel"))
+		Params(func() {
+			Param("jobID", Integer, "Job ID")
+			Param("by", String, "Who cancelled the job, which is recorded in the status of the job")
+		})
+		Response(Accepted, func() {
+			Media(Job, "light")
+		})
+		Response(NotFound)
+		Response(Conflict, ErrorMedia)
+	})
+})
+
+var _ = Resource("delivery", func() {
+	BasePath("/deliveries")
+	DefaultMedia(Delivery)
+
+	Action("list", func() {
+		Description("Get all received webhook deliveries, but without their headers and body")
+		Routing(GET(""))
+		Response(OK, func() {
+			Media(CollectionOf(Delivery), "light")
+		})
+	})
+
+	Action("show", func() {
+		Description("Get a delivery by its ID")
+		Routing(GET("/:deliveryID"))
+		Params(func() {
+			Param("deliveryID", Integer, "Delivery ID")
+		})
+		Response(OK)
+		Response(NotFound)
+	})
+
+	Action("replay", func() {
+		Description("Process a delivery again as if it was just received, returns the delivery that was created for the replay")
+		Routing(POST("/:deliveryID/replay"))
+		Params(func() {
+			Param("deliveryID", Integer, "Delivery ID")
+			Param("force", Boolean, "Queue a new job, even if the delivery was accepted before", func() {
+				Default(false)
+			})
+		})
+		Response(OK)
+		Response(NotFound)
+	})
 })
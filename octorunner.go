@@ -11,6 +11,7 @@ import (
 	"github.com/goadesign/goa/logging/logrus"
 	"github.com/goadesign/goa/middleware"
 	"github.com/spf13/viper"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"strings"
@@ -27,8 +28,22 @@ const (
 	webPortDefault      = "8080"
 	webPath             = "web.path"
 	webPathDefault      = "payload"
+	webRequireSignature = "web.require_signature"
 	databasePath        = "database.path"
 	databasePathDefault = "octorunner.db"
+	queueWorkers        = "queue.workers"
+	queueWorkersDefault = 2
+	queueSize           = "queue.size"
+	queueSizeDefault    = 0
+	queueAutoCancel     = "queue.auto_cancel"
+	githubBaseURL       = "github.base_url"
+	githubUploadURL     = "github.upload_url"
+	githubAppID         = "github.app.id"
+	githubAppKey        = "github.app.private_key"
+	githubAppSecret     = "github.app.secret"
+	mirrorDir           = "checkout.mirrors"
+	mirrorDirDefault    = "mirrors"
+	skipMarkers         = "skip_markers"
 )
 
 // Main entry point for our program. Used to read and set the configuration we'll be using, and setup a webserver.
@@ -59,7 +74,11 @@ func main() {
 	viper.SetDefault(webServer, webServerDefault)
 	viper.SetDefault(webPort, webPortDefault)
 	viper.SetDefault(webPath, webPathDefault)
+	viper.SetDefault(webRequireSignature, false)
 	viper.SetDefault(databasePath, databasePathDefault)
+	viper.SetDefault(queueWorkers, queueWorkersDefault)
+	viper.SetDefault(queueSize, queueSizeDefault)
+	viper.SetDefault(mirrorDir, mirrorDirDefault)
 
 	// Set log level
 	logLevel := strings.ToLower(viper.GetString(logLevel))
@@ -74,6 +93,17 @@ func main() {
 	webServer := viper.GetString(webServer)
 	webPort := viper.GetString(webPort)
 	webPath := viper.GetString(webPath)
+	git.RequireSignature = viper.GetBool(webRequireSignature)
+	if git.RequireSignature {
+		log.Info("Deliveries without a valid signature will be rejected")
+	}
+
+	// Get the Github Enterprise server to use, if any
+	git.GithubBaseURL = viper.GetString(githubBaseURL)
+	git.GithubUploadURL = viper.GetString(githubUploadURL)
+	if git.GithubBaseURL != "" {
+		log.Info("Using Github Enterprise server " + git.GithubBaseURL)
+	}
 
 	// See if the database exists
 	database := viper.GetString(databasePath)
@@ -97,6 +127,52 @@ func main() {
 		git.Auth = auth.SimpleAuth{Store: repositories}
 	}
 
+	// Authenticate as a Github App if one is configured
+	if appID := viper.GetInt64(githubAppID); appID != 0 {
+		privateKey, err := ioutil.ReadFile(viper.GetString(githubAppKey))
+		if err != nil {
+			log.Panicf("Cannot read private key of Github App: %q", err)
+		}
+		git.Auth, err = auth.NewGithubApp(appID, privateKey, viper.GetString(githubAppSecret), git.GithubAPIURL(),
+			repositories)
+		if err != nil {
+			log.Panicf("Cannot setup Github App authentication: %q", err)
+		}
+		log.Infof("Authenticating as Github App %d", appID)
+	}
+
+	// Start the workers that run queued jobs
+	workers := viper.GetInt(queueWorkers)
+	if workers < 1 {
+		log.Errorf("Number of workers was set to invalid value %d, defaulting to %d", workers, queueWorkersDefault)
+		workers = queueWorkersDefault
+	}
+	git.QueueSize = viper.GetInt64(queueSize)
+	git.AutoCancel = viper.GetBool(queueAutoCancel)
+	git.MirrorDir = viper.GetString(mirrorDir)
+	// Pipelines that download an archive don't need git, so an old version only affects checkout mode git
+	if err := git.CheckGitVersion(); err != nil {
+		log.Warnf("Pipelines can't use checkout mode git: %v", err)
+	}
+	git.SkipMarkers = viper.GetStringSlice(skipMarkers)
+	git.StartWorkers(workers)
+
+	// Start the schedules of repositories, which are configured alongside their authentication data
+	var scheduledRepositories map[string]struct {
+		Schedules []git.Schedule
+	}
+	err = viper.UnmarshalKey("repositories", &scheduledRepositories)
+	if err != nil {
+		log.Errorf("Cannot read schedules of repositories: %q", err)
+	}
+	schedules := make(map[string][]git.Schedule)
+	for repoFullName, repository := range scheduledRepositories {
+		if len(repository.Schedules) > 0 {
+			schedules[repoFullName] = repository.Schedules
+		}
+	}
+	git.StartScheduler(schedules)
+
 	// Capture os.Interrupt so we can close the db connection
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
@@ -130,6 +206,9 @@ func main() {
 	// Mount "project" controller
 	c2 := controllers.NewProjectController(service)
 	app.MountProjectController(service, c2)
+	// Mount "delivery" controller
+	c3 := controllers.NewDeliveryController(service)
+	app.MountDeliveryController(service, c3)
 
 	// Start service
 	if err := service.ListenAndServe(webServer + ":" + webPort); err != nil {